@@ -91,6 +91,10 @@ func main() {
 
 	server.RegisterRoutes(srv, engine)
 
+	// Фоновое обновление подписок; UI узнаёт о результатах через событие subscriptions_updated.
+	engine.SetBroadcast(func(event map[string]interface{}) { srv.Broadcast(event) })
+	engine.StartAutoRefresh(ctx)
+
 	go func() {
 		if err := srv.Start(ctx); err != nil {
 			log.Printf("HTTP server error: %v", err)
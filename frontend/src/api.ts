@@ -2,9 +2,21 @@ import type {
   ConnectPayload,
   CreateConfigPayload,
   CreateSubscriptionPayload,
+  ExportFormat,
+  ExportSkip,
+  ManualServerPayload,
+  PingPayload,
+  PingResult,
+  QRImportResult,
+  RulesPreview,
+  ServerNode,
+  ServerShare,
   SingBoxStatus,
   SiteCheckResult,
   Subscription,
+  SubscriptionDiff,
+  SubscriptionReport,
+  SubscriptionRules,
   VpnConfig,
   VpnSettings,
   VpnStatus,
@@ -58,6 +70,17 @@ export const addConfig = (payload: CreateConfigPayload) =>
     body: JSON.stringify(payload),
   })
 
+export const updateConfig = (id: string, patch: Partial<CreateConfigPayload>) =>
+  request<VpnConfig>(`/api/configs/${encodeURIComponent(id)}`, {
+    method: 'PUT',
+    body: JSON.stringify(patch),
+  })
+
+export const deleteConfig = (id: string) =>
+  request<void>(`/api/configs/${encodeURIComponent(id)}`, {
+    method: 'DELETE',
+  })
+
 export const addSubscription = (payload: CreateSubscriptionPayload) =>
   request<Subscription>('/api/subscriptions', {
     method: 'POST',
@@ -65,7 +88,7 @@ export const addSubscription = (payload: CreateSubscriptionPayload) =>
   })
 
 export const refreshSubscriptions = () =>
-  request<Array<{ id: string; status: string }>>('/api/subscriptions/refresh', {
+  request<Array<{ id: string; status: string; diff?: SubscriptionDiff }>>('/api/subscriptions/refresh', {
     method: 'POST',
   })
 
@@ -89,10 +112,33 @@ export const fetchSiteCheck = (params?: { name?: string; url?: string }) =>
   )
 
 export const refreshSubscription = (id: string) =>
-  request<{ id: string; status: string }>(`/api/subscriptions/${encodeURIComponent(id)}/refresh`, {
+  request<{ id: string; status: string; diff: SubscriptionDiff; current_server_removed: boolean }>(
+    `/api/subscriptions/${encodeURIComponent(id)}/refresh`,
+    { method: 'POST' },
+  )
+
+export const fetchSubscriptionReport = (id: string) =>
+  request<SubscriptionReport>(`/api/subscriptions/${encodeURIComponent(id)}/report`)
+
+export const previewSubscriptionRules = (id: string, rules: SubscriptionRules) =>
+  request<RulesPreview>(`/api/subscriptions/${encodeURIComponent(id)}/rules/preview`, {
     method: 'POST',
+    body: JSON.stringify(rules),
   })
 
+export const exportSubscription = async (id: string, format: ExportFormat) => {
+  const response = await fetch(
+    `${apiBase}/api/subscriptions/${encodeURIComponent(id)}/export?format=${format}`,
+  )
+  if (!response.ok) {
+    const text = await response.text()
+    throw new Error(text || `Request failed: ${response.status}`)
+  }
+  const header = response.headers.get('X-Export-Skipped')
+  const skipped: ExportSkip[] = header ? JSON.parse(decodeURIComponent(header)) : []
+  return { body: await response.text(), skipped }
+}
+
 export const connectVPN = (payload: ConnectPayload) =>
   request<VpnStatus>('/api/connect', {
     method: 'POST',
@@ -111,4 +157,62 @@ export const fetchServers = (configId: string) =>
     configId ? `/api/servers?config_id=${encodeURIComponent(configId)}` : '/api/servers',
   ).then((raw) => (Array.isArray(raw) ? raw.map(serverItem) : []))
 
+export const addManualServer = (payload: ManualServerPayload) =>
+  request<ServerNode>('/api/servers', {
+    method: 'POST',
+    body: JSON.stringify(payload),
+  })
+
+export const updateManualServer = (id: string, payload: Partial<ManualServerPayload>) =>
+  request<ServerNode>(`/api/servers/${encodeURIComponent(id)}`, {
+    method: 'PUT',
+    body: JSON.stringify(payload),
+  })
+
+export const deleteManualServer = (id: string) =>
+  request<void>(`/api/servers/${encodeURIComponent(id)}`, {
+    method: 'DELETE',
+  })
+
+// Результаты приходят NDJSON по мере замера: onResult вызывается для каждого сервера.
+export const pingServers = async (payload: PingPayload, onResult: (result: PingResult) => void) => {
+  const response = await fetch(`${apiBase}/api/servers/ping`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(payload),
+  })
+  if (!response.ok || !response.body) {
+    const text = await response.text()
+    throw new Error(text || `Request failed: ${response.status}`)
+  }
+  const reader = response.body.pipeThrough(new TextDecoderStream()).getReader()
+  let buffer = ''
+  for (;;) {
+    const { done, value } = await reader.read()
+    if (done) break
+    buffer += value
+    const lines = buffer.split('\n')
+    buffer = lines.pop() ?? ''
+    for (const line of lines) {
+      if (line.trim()) onResult(JSON.parse(line) as PingResult)
+    }
+  }
+}
+
+export const fetchServerShare = (id: string) =>
+  request<ServerShare>(`/api/servers/${encodeURIComponent(id)}/share`)
+
+export const importQRImage = async (image: Blob, name?: string) => {
+  const form = new FormData()
+  form.append('image', image)
+  if (name) form.append('name', name)
+  // Без request(): Content-Type с boundary браузер выставит сам.
+  const response = await fetch(`${apiBase}/api/import/qr`, { method: 'POST', body: form })
+  if (!response.ok) {
+    const text = await response.text()
+    throw new Error(text || `Request failed: ${response.status}`)
+  }
+  return response.json() as Promise<QRImportResult>
+}
+
 export const fetchLogs = () => request<string[]>('/api/logs')
@@ -1,6 +1,7 @@
 export type VpnStatus = {
   connected: boolean
   server: string
+  serverRemoved?: boolean
   activeConfigId: string
   configCount: number
   downloadSpeed: number
@@ -22,6 +23,64 @@ export type VpnConfig = {
   updated_at: number
 }
 
+export type SubscriptionDiffEntry = {
+  id: string
+  name: string
+  old_id?: string
+  old_name?: string
+}
+
+export type SubscriptionDiff = {
+  added: SubscriptionDiffEntry[]
+  removed: SubscriptionDiffEntry[]
+  changed: SubscriptionDiffEntry[]
+  unchanged: SubscriptionDiffEntry[]
+}
+
+export type SubscriptionLineReport = {
+  line: number
+  text?: string
+  name?: string
+  node_id?: string
+  status: 'accepted' | 'unsupported_scheme' | 'unsupported_transport' | 'malformed'
+  reason?: string
+  warnings?: string[]
+}
+
+export type SubscriptionReport = {
+  format: string
+  lines: SubscriptionLineReport[]
+  accepted: number
+  rejected: number
+  error?: string
+}
+
+export type FilterRule = {
+  field?: 'name' | 'host' | 'protocol' | 'country'
+  pattern: string
+}
+
+export type SubscriptionRules = {
+  include?: FilterRule[]
+  exclude?: FilterRule[]
+  rename?: string
+  prefix?: string
+}
+
+export type RuleResult = {
+  id: string
+  name: string
+  original_name: string
+  host?: string
+  protocol: string
+  reason?: string
+}
+
+export type RulesPreview = {
+  kept: RuleResult[]
+  dropped: RuleResult[]
+}
+
 export type Subscription = {
   id: string
   name: string
@@ -30,11 +89,88 @@ export type Subscription = {
   created_at?: number
   updated_at?: number
   expires_at?: number
+  upload?: number
+  download?: number
+  total?: number
+  profile_title?: string
+  update_interval?: number
+  web_page_url?: string
   last_error?: string
   last_success?: number
+  refresh_minutes?: number
+  next_refresh_at?: number
+  user_agent?: string
+  auth_user?: string
+  /** Секреты запроса API не отдаёт: только признаки и имена заголовков. */
+  has_auth?: boolean
+  has_proxy?: boolean
+  header_names?: string[]
+  fetch_via?: 'direct' | 'tunnel' | 'proxy'
+  /** URL прокси без учётных данных. */
+  fetch_proxy?: string
+  rules?: SubscriptionRules
   servers?: Array<{ id?: string; name?: string }>
 }
 
+export type ServerNode = {
+  id: string
+  name: string
+  address: string
+  country: string
+  /** Последняя задержка, мс: 0 — не измерялась, -1 — сервер не ответил. */
+  ping: number
+  /** Когда измерена ping (Unix, секунды). */
+  pinged_at?: number
+  uri?: string
+  outbound?: Record<string, unknown>
+}
+
+export type PingPayload = {
+  /** Пусто — все серверы. */
+  ids?: string[]
+  /** tcp — время TCP-соединения; url — HTTP-запрос через сервер во временном sing-box. */
+  mode?: 'tcp' | 'url'
+  url?: string
+}
+
+export type PingResult = {
+  id: string
+  ping: number
+  pinged_at?: number
+  error?: string
+}
+
+export type ManualServerPayload = {
+  /** Share-ссылка или JSON одного outbound sing-box. */
+  uri?: string
+  /** Outbound sing-box как есть (вместо uri); detour может быть ID другого сервера. */
+  outbound?: Record<string, unknown>
+  name?: string
+}
+
+export type ServerShare = {
+  id: string
+  name: string
+  uri: string
+  /** PNG с QR-кодом ссылки (data URL). */
+  qr: string
+}
+
+export type QRImportResult = {
+  kind: 'servers' | 'config' | 'subscription'
+  servers?: ServerNode[]
+  subscription?: Subscription
+}
+
+export type ExportFormat = 'uri' | 'base64' | 'clash' | 'singbox'
+
+// Узел, не попавший в экспорт (формат его не выражает или он подключается через другой сервер).
+export type ExportSkip = {
+  id: string
+  name: string
+  reason: string
+}
+
 export type CreateConfigPayload = {
   name: string
   content: string
@@ -55,6 +191,10 @@ export type VpnSettings = {
   default_config_id?: string
   default_server?: string
   sing_box_path?: string
+  /** Общий интервал автообновления, минуты (не меньше 5; <0 — выключено). 0 в патче снимает интервал. */
+  subscription_refresh_minutes?: number
+  /** uTLS-отпечаток по умолчанию для vless/vmess/trojan ('none' — выключен). */
+  utls_fingerprint?: string
 }
 
 export type SingBoxStatus = {
@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// FileNames — имена базы в каталоге данных, в порядке приоритета (GeoLite2/DB-IP Country в формате MaxMind).
+var FileNames = []string{"GeoLite2-Country.mmdb", "country.mmdb"}
+
+// DB — открытая база GeoIP.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// Open открывает базу из dataDir. Если файла нет — (nil, nil): GeoIP необязателен.
+func Open(dataDir string) (*DB, error) {
+	for _, name := range FileNames {
+		path := filepath.Join(dataDir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &DB{reader: reader}, nil
+	}
+	return nil, nil
+}
+
+// Country — ISO-код страны для IP; пусто, если адреса нет в базе.
+func (d *DB) Country(ip net.IP) string {
+	if d == nil || ip == nil {
+		return ""
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		// Для anycast и некоторых сетей страна указана только как registered_country.
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	if err := d.reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	code := record.Country.ISOCode
+	if code == "" {
+		code = record.RegisteredCountry.ISOCode
+	}
+	return strings.ToUpper(code)
+}
+
+func (d *DB) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.reader.Close()
+}
@@ -148,8 +148,9 @@ func (m *NetModule) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryR
 		return &pb.QueryResponse{Success: true, Data: data}, nil
 	case "status":
 		data, _ := json.Marshal(map[string]interface{}{
-			"status": m.engine.GetStatus(),
-			"server": m.engine.GetCurrentServer(),
+			"status":         m.engine.GetStatus(),
+			"server":         m.engine.GetCurrentServer(),
+			"server_removed": m.engine.CurrentServerRemoved(),
 		})
 		return &pb.QueryResponse{Success: true, Data: data}, nil
 	}
@@ -158,8 +159,9 @@ func (m *NetModule) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryR
 
 func (m *NetModule) GetSnapshot(ctx context.Context, _ *pb.Empty) (*pb.StateSnapshot, error) {
 	state := map[string]interface{}{
-		"status":       m.engine.GetStatus(),
-		"current_node": m.engine.GetCurrentServer(),
+		"status":         m.engine.GetStatus(),
+		"current_node":   m.engine.GetCurrentServer(),
+		"server_removed": m.engine.CurrentServerRemoved(),
 	}
 	data, _ := json.Marshal(state)
 	return &pb.StateSnapshot{
@@ -0,0 +1,442 @@
+package qrscan
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"unicode/utf8"
+)
+
+// grid — модули кода, снятые с картинки: true — тёмный.
+type grid struct {
+	dim  int
+	bits []bool
+}
+
+func (g *grid) at(x, y int) bool {
+	return g.bits[y*g.dim+x]
+}
+
+var (
+	errFormat   = errors.New("qr: unreadable format information")
+	errChecksum = errors.New("qr: too many errors to correct")
+)
+
+// Уровни коррекции в порядке таблиц ниже.
+const (
+	levelL = iota
+	levelM
+	levelQ
+	levelH
+)
+
+// eccPerBlock и eccBlocks — ISO/IEC 18004, таблица 9: байт коррекции на блок и число блоков
+// для каждой версии (индекс 0 не используется).
+var eccPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// decode читает формат, снимает маску, исправляет ошибки и разбирает сегменты данных.
+func (g *grid) decode() (string, error) {
+	level, mask, ok := g.readFormat()
+	if !ok {
+		return "", errFormat
+	}
+	version := (g.dim - 17) / 4
+	raw := g.readCodewords(version, mask)
+	data, err := correctBlocks(raw, version, level)
+	if err != nil {
+		return "", err
+	}
+	return decodeSegments(data, version)
+}
+
+// readFormat сравнивает обе копии 15-битной информации о формате со всеми 32 допустимыми кодами.
+func (g *grid) readFormat() (level, mask int, ok bool) {
+	bit := func(x, y int) int {
+		if g.at(x, y) {
+			return 1
+		}
+		return 0
+	}
+	var a, b int
+	for x := 0; x < 6; x++ {
+		a = a<<1 | bit(x, 8)
+	}
+	a = a<<1 | bit(7, 8)
+	a = a<<1 | bit(8, 8)
+	a = a<<1 | bit(8, 7)
+	for y := 5; y >= 0; y-- {
+		a = a<<1 | bit(8, y)
+	}
+	for y := g.dim - 1; y >= g.dim-7; y-- {
+		b = b<<1 | bit(8, y)
+	}
+	for x := g.dim - 8; x < g.dim; x++ {
+		b = b<<1 | bit(x, 8)
+	}
+	best, bestDist := -1, 4
+	for data := 0; data < 32; data++ {
+		code := formatCode(data)
+		for _, got := range []int{a, b} {
+			if d := bits.OnesCount(uint(code ^ got)); d < bestDist {
+				best, bestDist = data, d
+			}
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	// Биты уровня в формате: L=01, M=00, Q=11, H=10.
+	level = [4]int{levelM, levelL, levelH, levelQ}[best>>3]
+	return level, best & 7, true
+}
+
+// formatCode — BCH(15,5) код формата с маской 0x5412.
+func formatCode(data int) int {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// readVersion читает 18-битную информацию о версии (есть начиная с версии 7) из верхнего правого блока.
+func (g *grid) readVersion() (int, bool) {
+	var got int
+	for i := 17; i >= 0; i-- {
+		got <<= 1
+		if g.at(g.dim-11+i%3, i/3) {
+			got |= 1
+		}
+	}
+	for v := 7; v <= 40; v++ {
+		if bits.OnesCount(uint(versionCode(v)^got)) <= 3 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// versionCode — BCH(18,6) код версии.
+func versionCode(v int) int {
+	rem := v
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return v<<12 | rem
+}
+
+// readCodewords обходит модули данных зигзагом (по два столбца снизу вверх и обратно) и снимает маску.
+func (g *grid) readCodewords(version, mask int) []byte {
+	function := functionPatterns(version)
+	out := make([]byte, 0, rawDataModules(version)/8)
+	var cur byte
+	n := 0
+	up := true
+	for right := g.dim - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for i := 0; i < g.dim; i++ {
+			y := i
+			if up {
+				y = g.dim - 1 - i
+			}
+			for col := 0; col < 2; col++ {
+				x := right - col
+				if function[y*g.dim+x] {
+					continue
+				}
+				cur <<= 1
+				if g.at(x, y) != masked(mask, y, x) {
+					cur |= 1
+				}
+				if n++; n == 8 {
+					out = append(out, cur)
+					cur, n = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+	return out[:rawDataModules(version)/8]
+}
+
+// masked — условие маски для модуля (row, col).
+func masked(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return row*col%2+row*col%3 == 0
+	case 6:
+		return (row*col%2+row*col%3)%2 == 0
+	default:
+		return ((row+col)%2+row*col%3)%2 == 0
+	}
+}
+
+// functionPatterns — служебные модули (узоры, синхронизация, формат, версия), в которых нет данных.
+func functionPatterns(version int) []bool {
+	dim := 17 + 4*version
+	m := make([]bool, dim*dim)
+	region := func(left, top, w, h int) {
+		for y := top; y < top+h; y++ {
+			for x := left; x < left+w; x++ {
+				m[y*dim+x] = true
+			}
+		}
+	}
+	region(0, 0, 9, 9)
+	region(dim-8, 0, 8, 9)
+	region(0, dim-8, 9, 8)
+	pos := alignmentPositions(version)
+	last := len(pos) - 1
+	for i := range pos {
+		for j := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			region(pos[i]-2, pos[j]-2, 5, 5)
+		}
+	}
+	region(6, 9, 1, dim-17)
+	region(9, 6, dim-17, 1)
+	if version >= 7 {
+		region(dim-11, 0, 3, 6)
+		region(0, dim-11, 6, 3)
+	}
+	return m
+}
+
+// alignmentPositions — координаты центров выравнивающих узоров по одной оси.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	}
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, 17+4*version-7; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// rawDataModules — сколько модулей версии отведено под данные и коррекцию (включая остаточные биты).
+func rawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// correctBlocks раскладывает перемешанные байты по блокам, исправляет ошибки и склеивает данные.
+func correctBlocks(raw []byte, version, level int) ([]byte, error) {
+	numBlocks := eccBlocks[level][version]
+	eccLen := eccPerBlock[level][version]
+	total := len(raw)
+	numShort := numBlocks - total%numBlocks
+	shortLen := total / numBlocks
+	blocks := make([][]byte, numBlocks)
+	for i := range blocks {
+		blocks[i] = make([]byte, shortLen+1)
+	}
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			// У коротких блоков на один байт данных меньше: в этой позиции их пропускают.
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j][i] = raw[k]
+			k++
+		}
+	}
+	var data []byte
+	for j, block := range blocks {
+		if j < numShort {
+			block = append(block[:shortLen-eccLen], block[shortLen-eccLen+1:]...)
+		}
+		if err := rsCorrect(block, eccLen); err != nil {
+			return nil, err
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+	return data, nil
+}
+
+// Режимы сегментов данных.
+const (
+	modeTerminator  = 0
+	modeNumeric     = 1
+	modeAlphanum    = 2
+	modeStructured  = 3
+	modeByte        = 4
+	modeFNC1First   = 5
+	modeECI         = 7
+	modeKanji       = 8
+	modeFNC1Second  = 9
+	alphanumCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+)
+
+// decodeSegments разбирает поток бит в текст. Байтовый режим считается UTF-8 (так кодируют ссылки
+// все распространённые генераторы); невалидный UTF-8 читается как Latin-1.
+func decodeSegments(data []byte, version int) (string, error) {
+	r := &bitReader{data: data}
+	var out strings.Builder
+	for r.left() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case modeTerminator:
+			return finishText(out.String()), nil
+		case modeNumeric:
+			count, ok := r.read(charCountBits(mode, version))
+			for ; ok && count >= 3; count -= 3 {
+				var v int
+				if v, ok = r.read(10); ok {
+					out.WriteString(fmt.Sprintf("%03d", v))
+				}
+			}
+			if ok && count > 0 {
+				var v int
+				if v, ok = r.read(1 + 3*count); ok {
+					out.WriteString(fmt.Sprintf("%0*d", count, v))
+				}
+			}
+			if !ok {
+				return "", fmt.Errorf("qr: truncated numeric segment")
+			}
+		case modeAlphanum:
+			count, ok := r.read(charCountBits(mode, version))
+			for ; ok && count >= 2; count -= 2 {
+				var v int
+				if v, ok = r.read(11); ok && v/45 < 45 {
+					out.WriteByte(alphanumCharset[v/45])
+					out.WriteByte(alphanumCharset[v%45])
+				}
+			}
+			if ok && count == 1 {
+				var v int
+				if v, ok = r.read(6); ok && v < 45 {
+					out.WriteByte(alphanumCharset[v])
+				}
+			}
+			if !ok {
+				return "", fmt.Errorf("qr: truncated alphanumeric segment")
+			}
+		case modeByte:
+			count, ok := r.read(charCountBits(mode, version))
+			for ; ok && count > 0; count-- {
+				var v int
+				if v, ok = r.read(8); ok {
+					out.WriteByte(byte(v))
+				}
+			}
+			if !ok {
+				return "", fmt.Errorf("qr: truncated byte segment")
+			}
+		case modeECI:
+			// Кодировка: байтовый режим и так читаем как UTF-8, поэтому назначение только пропускаем.
+			first, _ := r.read(8)
+			switch {
+			case first&0x80 == 0:
+			case first&0xC0 == 0x80:
+				r.read(8)
+			case first&0xE0 == 0xC0:
+				r.read(16)
+			}
+		case modeStructured:
+			r.read(16)
+		case modeFNC1First:
+		case modeFNC1Second:
+			r.read(8)
+		default:
+			return "", fmt.Errorf("qr: unsupported segment mode %d", mode)
+		}
+	}
+	return finishText(out.String()), nil
+}
+
+func charCountBits(mode, version int) int {
+	i := 0
+	switch {
+	case version >= 27:
+		i = 2
+	case version >= 10:
+		i = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return [3]int{10, 12, 14}[i]
+	case modeAlphanum:
+		return [3]int{9, 11, 13}[i]
+	case modeKanji:
+		return [3]int{8, 10, 12}[i]
+	default:
+		return [3]int{8, 16, 16}[i]
+	}
+}
+
+func finishText(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		runes = append(runes, rune(s[i]))
+	}
+	return string(runes)
+}
+
+type bitReader struct {
+	data []byte
+	pos  int // в битах
+}
+
+func (r *bitReader) left() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) (int, bool) {
+	if n > r.left() {
+		r.pos = len(r.data) * 8
+		return 0, false
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		b := r.data[(r.pos+i)/8] >> (7 - uint((r.pos+i)%8)) & 1
+		v = v<<1 | int(b)
+	}
+	r.pos += n
+	return v, true
+}
@@ -0,0 +1,381 @@
+package qrscan
+
+import (
+	"math"
+	"sort"
+)
+
+// finder — найденный поисковый узор (квадрат 7×7 в углу кода).
+type finder struct {
+	x, y   float64
+	module float64
+	count  int // сколько строк подтвердили узор
+}
+
+// maxFinderCandidates — сколько самых надёжных кандидатов перебирать тройками.
+const maxFinderCandidates = 12
+
+// findFinders сканирует строки в поисках пропорции 1:1:3:1:1 (тёмный-светлый-тёмный-светлый-тёмный)
+// и подтверждает каждую находку вертикальным и повторным горизонтальным проходом.
+func (b *bitmap) findFinders() []finder {
+	var found []finder
+	for y := 0; y < b.h; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x < b.w; x++ {
+			if b.at(x, y) {
+				if state&1 == 1 {
+					state++
+				}
+				counts[state]++
+				continue
+			}
+			if state&1 == 1 {
+				counts[state]++
+				continue
+			}
+			if state < 4 {
+				state++
+				counts[state]++
+				continue
+			}
+			if isFinderRatio(counts) {
+				found = b.confirmFinder(found, counts, x, y)
+			}
+			counts = [5]int{counts[2], counts[3], counts[4], 1, 0}
+			state = 3
+		}
+		if state == 4 && isFinderRatio(counts) {
+			found = b.confirmFinder(found, counts, b.w, y)
+		}
+	}
+	return found
+}
+
+func isFinderRatio(c [5]int) bool {
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	variance := module / 2
+	return math.Abs(module-float64(c[0])) < variance &&
+		math.Abs(module-float64(c[1])) < variance &&
+		math.Abs(3*module-float64(c[2])) < 3*variance &&
+		math.Abs(module-float64(c[3])) < variance &&
+		math.Abs(module-float64(c[4])) < variance
+}
+
+// confirmFinder проверяет кандидата по столбцу и снова по строке; подтверждённый узор
+// сливается с уже найденным рядом или добавляется новым.
+func (b *bitmap) confirmFinder(found []finder, c [5]int, end, y int) []finder {
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	cx := float64(end-c[4]-c[3]) - float64(c[2])/2
+	cy, vTotal, ok := b.crossCheck(int(cx), y, c[2], total, true)
+	if !ok {
+		return found
+	}
+	cx, hTotal, ok := b.crossCheck(int(cx), int(cy), c[2], total, false)
+	if !ok {
+		return found
+	}
+	module := float64(vTotal+hTotal) / 14
+	for i := range found {
+		f := &found[i]
+		if math.Abs(f.x-cx) <= f.module && math.Abs(f.y-cy) <= f.module && math.Abs(f.module-module) <= math.Max(1, f.module/2) {
+			n := float64(f.count)
+			f.x = (f.x*n + cx) / (n + 1)
+			f.y = (f.y*n + cy) / (n + 1)
+			f.module = (f.module*n + module) / (n + 1)
+			f.count++
+			return found
+		}
+	}
+	return append(found, finder{x: cx, y: cy, module: module, count: 1})
+}
+
+// crossCheck проходит через (x, y) по столбцу (vertical) или строке и проверяет пропорцию узора.
+// Возвращает центр вдоль оси и длину узора в пикселях.
+func (b *bitmap) crossCheck(x, y, maxCount, origTotal int, vertical bool) (float64, int, bool) {
+	pos, n := x, b.w
+	at := func(i int) bool { return b.at(i, y) }
+	if vertical {
+		pos, n = y, b.h
+		at = func(i int) bool { return b.at(x, i) }
+	}
+	if pos < 0 || pos >= n || !at(pos) {
+		return 0, 0, false
+	}
+	var c [5]int
+	i := pos
+	for ; i >= 0 && at(i); i-- {
+		c[2]++
+	}
+	for ; i >= 0 && !at(i) && c[1] <= maxCount; i-- {
+		c[1]++
+	}
+	if i < 0 || c[1] > maxCount {
+		return 0, 0, false
+	}
+	for ; i >= 0 && at(i) && c[0] <= maxCount; i-- {
+		c[0]++
+	}
+	if c[0] > maxCount {
+		return 0, 0, false
+	}
+	for i = pos + 1; i < n && at(i); i++ {
+		c[2]++
+	}
+	for ; i < n && !at(i) && c[3] <= maxCount; i++ {
+		c[3]++
+	}
+	if i == n || c[3] > maxCount {
+		return 0, 0, false
+	}
+	for ; i < n && at(i) && c[4] <= maxCount; i++ {
+		c[4]++
+	}
+	if c[4] > maxCount {
+		return 0, 0, false
+	}
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	if 5*abs(total-origTotal) >= 2*origTotal || !isFinderRatio(c) {
+		return 0, 0, false
+	}
+	return float64(i-c[4]-c[3]) - float64(c[2])/2, total, true
+}
+
+// triple — три узора, упорядоченные как верхний левый, верхний правый и нижний левый углы.
+type triple struct {
+	tl, tr, bl finder
+	module     float64
+	score      float64 // отклонение от идеального прямоугольного равнобедренного треугольника; меньше — лучше
+}
+
+// bestTriples перебирает тройки кандидатов и возвращает геометрически правдоподобные, лучшие первыми.
+func bestTriples(found []finder) []triple {
+	sort.SliceStable(found, func(i, j int) bool { return found[i].count > found[j].count })
+	// Узор, подтверждённый одной строкой, — чаще всего шум; берём их, только если иначе не набрать трёх.
+	confirmed := 0
+	for _, f := range found {
+		if f.count >= 2 {
+			confirmed++
+		}
+	}
+	if confirmed >= 3 {
+		found = found[:confirmed]
+	}
+	if len(found) > maxFinderCandidates {
+		found = found[:maxFinderCandidates]
+	}
+	var out []triple
+	for i := 0; i < len(found); i++ {
+		for j := i + 1; j < len(found); j++ {
+			for k := j + 1; k < len(found); k++ {
+				if t, ok := orderTriple(found[i], found[j], found[k]); ok {
+					out = append(out, t)
+				}
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score < out[j].score })
+	return out
+}
+
+func orderTriple(a, b, c finder) (triple, bool) {
+	ab, bc, ac := distance(a, b), distance(b, c), distance(a, c)
+	var tl, p, q finder
+	switch {
+	case bc >= ab && bc >= ac:
+		tl, p, q = a, b, c
+	case ac >= ab && ac >= bc:
+		tl, p, q = b, a, c
+	default:
+		tl, p, q = c, a, b
+	}
+	// В координатах картинки (y вниз) верхний правый угол — по часовой стрелке от нижнего левого.
+	if (p.x-tl.x)*(q.y-tl.y)-(p.y-tl.y)*(q.x-tl.x) < 0 {
+		p, q = q, p
+	}
+	l1, l2, hyp := distance(tl, p), distance(tl, q), distance(p, q)
+	legs := math.Abs(l1-l2) / math.Max(l1, l2)
+	diagonal := math.Abs(hyp-math.Hypot(l1, l2)) / hyp
+	minModule := math.Min(tl.module, math.Min(p.module, q.module))
+	maxModule := math.Max(tl.module, math.Max(p.module, q.module))
+	if legs > 0.2 || diagonal > 0.1 || minModule/maxModule < 0.6 {
+		return triple{}, false
+	}
+	// Между центрами узоров не меньше 14 модулей (версия 1: 21 - 7); у повёрнутого кода размер модуля
+	// по строкам и столбцам завышен до √2 раз.
+	module := (tl.module + p.module + q.module) / 3
+	if l1/module < 9 {
+		return triple{}, false
+	}
+	return triple{tl: tl, tr: p, bl: q, module: module, score: legs + diagonal + 1 - minModule/maxModule}, true
+}
+
+// measure уточняет размер модуля тройки по ширине узоров вдоль сторон кода: поперечные проходы при поиске
+// завышают его до √2 раз, если код повёрнут.
+func (b *bitmap) measure(t triple) triple {
+	var sum float64
+	n := 0
+	for _, pair := range [][2]finder{{t.tl, t.tr}, {t.tr, t.tl}, {t.tl, t.bl}, {t.bl, t.tl}} {
+		if w, ok := b.finderWidth(pair[0], pair[1]); ok {
+			sum += w
+			n++
+		}
+	}
+	if n > 0 {
+		t.module = sum / float64(n) / 7
+	}
+	return t
+}
+
+// finderWidth — ширина узора f по прямой к узору to: от центра в обе стороны до выхода из внешней тёмной рамки.
+func (b *bitmap) finderWidth(f, to finder) (float64, bool) {
+	d := distance(f, to)
+	dx, dy := (to.x-f.x)/d, (to.y-f.y)/d
+	limit := int(5 * f.module)
+	width := -1.0 // шаги по целым пикселям перелетают границу в среднем на полпикселя с каждой стороны
+	for _, sign := range []float64{1, -1} {
+		transitions, dark, i := 0, true, 0
+		for ; i <= limit && transitions < 3; i++ {
+			x, y := int(math.Floor(f.x+sign*dx*float64(i))), int(math.Floor(f.y+sign*dy*float64(i)))
+			if x < 0 || y < 0 || x >= b.w || y >= b.h {
+				return 0, false
+			}
+			if b.at(x, y) != dark {
+				dark = !dark
+				transitions++
+			}
+		}
+		if transitions < 3 {
+			return 0, false
+		}
+		width += float64(i - 1)
+	}
+	return width, true
+}
+
+// versions — версии кода, которые стоит попробовать для тройки: оценка по расстоянию между узорами и соседние.
+func (t triple) versions() []int {
+	modules := (distance(t.tl, t.tr)+distance(t.tl, t.bl))/2/t.module + 7
+	v := int(math.Round((modules - 17) / 4))
+	var out []int
+	for _, c := range []int{v, v + 1, v - 1} {
+		if c >= 1 && c <= 40 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func distance(a, b finder) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// maxAlignmentCandidates — сколько ближайших к оценке выравнивающих узоров пробовать: при сильном наклоне
+// оценка уходит на десяток модулей, и ближе оказываются соседние выравнивающие узоры и похожие рисунки в данных.
+const maxAlignmentCandidates = 12
+
+// alignmentAllowance — в каком радиусе от оценки (в модулях) искать выравнивающий узор.
+const alignmentAllowance = 16
+
+// findAlignments ищет выравнивающий узор (тёмный модуль в светлой рамке внутри тёмной, 5×5) около est.
+// Строки сканируются на пропорцию 1:1:1 (светлый-тёмный-светлый), находка подтверждается по столбцу.
+// Возвращает кандидатов, ближайших к est первыми.
+func (b *bitmap) findAlignments(est point, module float64) []point {
+	r := int(math.Ceil(alignmentAllowance * module))
+	x0, x1 := max(0, int(est.x)-r), min(b.w, int(est.x)+r+1)
+	y0, y1 := max(0, int(est.y)-r), min(b.h, int(est.y)+r+1)
+	var found []point
+	for y := y0; y < y1; y++ {
+		var c [3]int
+		state := 0
+		for x := x0; x < x1; x++ {
+			dark := b.at(x, y)
+			switch {
+			case state == 1 && dark, state != 1 && !dark:
+				c[state]++
+				continue
+			case state < 2:
+				state++
+				c[state]++
+				continue
+			}
+			// Светлый-тёмный-светлый закончился на тёмном пикселе.
+			if p, ok := b.checkAlignment(c, x, y, module); ok {
+				found = mergeAlignment(found, p, module)
+			}
+			c = [3]int{c[2], 1, 0}
+			state = 1
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return math.Hypot(found[i].x-est.x, found[i].y-est.y) < math.Hypot(found[j].x-est.x, found[j].y-est.y)
+	})
+	return found[:min(len(found), maxAlignmentCandidates)]
+}
+
+// mergeAlignment добавляет находку, если это не тот же узор, найденный соседней строкой.
+func mergeAlignment(found []point, p point, module float64) []point {
+	for _, f := range found {
+		if math.Abs(f.x-p.x) <= module && math.Abs(f.y-p.y) <= module {
+			return found
+		}
+	}
+	return append(found, p)
+}
+
+// checkAlignment проверяет пропорцию 1:1:1 в строке (end — первый пиксель после светлого участка)
+// и тот же узор по столбцу через центр тёмного участка.
+func (b *bitmap) checkAlignment(c [3]int, end, y int, module float64) (point, bool) {
+	if !isAlignmentRatio(c, module) {
+		return point{}, false
+	}
+	cx := float64(end-c[2]) - float64(c[1])/2
+	x := int(cx)
+	if !b.at(x, y) {
+		return point{}, false
+	}
+	limit := int(2 * module)
+	var v [3]int
+	i := y
+	for ; i >= 0 && b.at(x, i) && v[1] <= limit; i-- {
+		v[1]++
+	}
+	for ; i >= 0 && !b.at(x, i) && v[0] <= limit; i-- {
+		v[0]++
+	}
+	if i < 0 {
+		return point{}, false
+	}
+	for i = y + 1; i < b.h && b.at(x, i) && v[1] <= limit; i++ {
+		v[1]++
+	}
+	for ; i < b.h && !b.at(x, i) && v[2] <= limit; i++ {
+		v[2]++
+	}
+	if i == b.h || !isAlignmentRatio(v, module) {
+		return point{}, false
+	}
+	cy := float64(i-v[2]) - float64(v[1])/2
+	return point{x: cx, y: cy}, true
+}
+
+func isAlignmentRatio(c [3]int, module float64) bool {
+	variance := module / 2
+	for _, n := range c {
+		if math.Abs(module-float64(n)) >= variance {
+			return false
+		}
+	}
+	return true
+}
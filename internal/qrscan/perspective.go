@@ -0,0 +1,90 @@
+package qrscan
+
+import "math"
+
+// point — точка на картинке или в координатах модулей кода.
+type point struct {
+	x, y float64
+}
+
+// perspective — проективное преобразование плоскости: (x, y) → (X/W, Y/W),
+// где [X Y W] = m · [x y 1]. Переводит координаты модулей в пиксели с учётом наклона камеры.
+type perspective struct {
+	m [3][3]float64
+}
+
+func (p perspective) apply(x, y float64) (float64, float64) {
+	w := p.m[2][0]*x + p.m[2][1]*y + p.m[2][2]
+	return (p.m[0][0]*x + p.m[0][1]*y + p.m[0][2]) / w, (p.m[1][0]*x + p.m[1][1]*y + p.m[1][2]) / w
+}
+
+// quadToQuad — преобразование, переводящее четырёхугольник src в dst (вершины по порядку обхода).
+func quadToQuad(src, dst [4]point) (perspective, bool) {
+	from, ok := squareToQuad(src)
+	if !ok {
+		return perspective{}, false
+	}
+	inv, ok := from.inverse()
+	if !ok {
+		return perspective{}, false
+	}
+	to, ok := squareToQuad(dst)
+	if !ok {
+		return perspective{}, false
+	}
+	return to.times(inv), true
+}
+
+// squareToQuad переводит единичный квадрат (0,0), (1,0), (1,1), (0,1) в четырёхугольник q.
+func squareToQuad(q [4]point) (perspective, bool) {
+	dx3 := q[0].x - q[1].x + q[2].x - q[3].x
+	dy3 := q[0].y - q[1].y + q[2].y - q[3].y
+	var g, h float64
+	if dx3 != 0 || dy3 != 0 {
+		dx1, dx2 := q[1].x-q[2].x, q[3].x-q[2].x
+		dy1, dy2 := q[1].y-q[2].y, q[3].y-q[2].y
+		denom := dx1*dy2 - dx2*dy1
+		if math.Abs(denom) < 1e-12 {
+			return perspective{}, false
+		}
+		g = (dx3*dy2 - dx2*dy3) / denom
+		h = (dx1*dy3 - dx3*dy1) / denom
+	}
+	return perspective{m: [3][3]float64{
+		{q[1].x - q[0].x + g*q[1].x, q[3].x - q[0].x + h*q[3].x, q[0].x},
+		{q[1].y - q[0].y + g*q[1].y, q[3].y - q[0].y + h*q[3].y, q[0].y},
+		{g, h, 1},
+	}}, true
+}
+
+func (p perspective) times(o perspective) perspective {
+	var out perspective
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out.m[i][j] += p.m[i][k] * o.m[k][j]
+			}
+		}
+	}
+	return out
+}
+
+// inverse — обратное преобразование (присоединённая матрица: общий множитель для проективного не важен).
+func (p perspective) inverse() (perspective, bool) {
+	m := p.m
+	var adj perspective
+	adj.m[0][0] = m[1][1]*m[2][2] - m[1][2]*m[2][1]
+	adj.m[0][1] = m[0][2]*m[2][1] - m[0][1]*m[2][2]
+	adj.m[0][2] = m[0][1]*m[1][2] - m[0][2]*m[1][1]
+	adj.m[1][0] = m[1][2]*m[2][0] - m[1][0]*m[2][2]
+	adj.m[1][1] = m[0][0]*m[2][2] - m[0][2]*m[2][0]
+	adj.m[1][2] = m[0][2]*m[1][0] - m[0][0]*m[1][2]
+	adj.m[2][0] = m[1][0]*m[2][1] - m[1][1]*m[2][0]
+	adj.m[2][1] = m[0][1]*m[2][0] - m[0][0]*m[2][1]
+	adj.m[2][2] = m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	det := m[0][0]*adj.m[0][0] + m[0][1]*adj.m[1][0] + m[0][2]*adj.m[2][0]
+	if math.Abs(det) < 1e-12 {
+		return perspective{}, false
+	}
+	return adj, true
+}
@@ -0,0 +1,288 @@
+// Package qrscan распознаёт QR-коды на картинках (скриншоты, сохранённые PNG/JPEG).
+// Сетка модулей восстанавливается по трём поисковым узорам и нижнему правому выравнивающему
+// перспективным преобразованием (поворот, масштаб и умеренный наклон камеры). У версии 1 выравнивающего
+// узора нет — четвёртая точка подбирается около аффинной оценки; если узор не найден — аффинное по трём.
+package qrscan
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"slices"
+)
+
+// ErrNotFound — на картинке нет читаемого QR-кода.
+var ErrNotFound = errors.New("no readable qr code found")
+
+// DecodeBytes декодирует картинку (PNG, JPEG, GIF) и читает из неё QR-код.
+func DecodeBytes(data []byte) (string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("qr: %w", err)
+	}
+	return Decode(img)
+}
+
+// Decode возвращает содержимое первого прочитанного QR-кода.
+// Пробует глобальный и локальный порог яркости, а также инверсию (светлый код на тёмном фоне).
+// Если не вышло — то же после медианного фильтра (точечный шум рвёт пропорции поисковых узоров).
+func Decode(img image.Image) (string, error) {
+	lum := newLuminance(img)
+	if text, err := lum.decode(); err == nil {
+		return text, nil
+	}
+	return lum.median().decode()
+}
+
+func (l *luminance) decode() (string, error) {
+	for _, binarize := range []func(*luminance) *bitmap{otsuThreshold, localThreshold} {
+		b := binarize(l)
+		for _, inverted := range []bool{false, true} {
+			if inverted {
+				b = b.inverted()
+			}
+			if text, err := b.decode(); err == nil {
+				return text, nil
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// luminance — яркость пикселей 0..255; прозрачность смешивается с белым фоном.
+type luminance struct {
+	w, h int
+	pix  []uint8
+}
+
+func newLuminance(img image.Image) *luminance {
+	bounds := img.Bounds()
+	l := &luminance{w: bounds.Dx(), h: bounds.Dy()}
+	l.pix = make([]uint8, l.w*l.h)
+	if ycc, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < l.h; y++ {
+			for x := 0; x < l.w; x++ {
+				l.pix[y*l.w+x] = ycc.Y[ycc.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			}
+		}
+		return l
+	}
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			v := (19595*r+38470*g+7471*b+1<<15)>>24 + (0xffff-a)>>8
+			if v > 255 {
+				v = 255
+			}
+			l.pix[y*l.w+x] = uint8(v)
+		}
+	}
+	return l
+}
+
+// median — медиана яркости по окну 3×3 (у краёв — по части окна внутри картинки).
+func (l *luminance) median() *luminance {
+	out := &luminance{w: l.w, h: l.h, pix: make([]uint8, len(l.pix))}
+	var window [9]uint8
+	for y := 0; y < l.h; y++ {
+		for x := 0; x < l.w; x++ {
+			n := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if xx, yy := x+dx, y+dy; xx >= 0 && yy >= 0 && xx < l.w && yy < l.h {
+						window[n] = l.pix[yy*l.w+xx]
+						n++
+					}
+				}
+			}
+			slices.Sort(window[:n])
+			out.pix[y*l.w+x] = window[n/2]
+		}
+	}
+	return out
+}
+
+// bitmap — чёрно-белая картинка: true — тёмный пиксель.
+type bitmap struct {
+	w, h int
+	dark []bool
+}
+
+func (b *bitmap) at(x, y int) bool {
+	return b.dark[y*b.w+x]
+}
+
+func (b *bitmap) inverted() *bitmap {
+	out := &bitmap{w: b.w, h: b.h, dark: make([]bool, len(b.dark))}
+	for i, d := range b.dark {
+		out.dark[i] = !d
+	}
+	return out
+}
+
+// otsuThreshold — один порог на всю картинку (метод Оцу); хорош для скриншотов.
+func otsuThreshold(l *luminance) *bitmap {
+	var hist [256]int
+	for _, v := range l.pix {
+		hist[v]++
+	}
+	total := len(l.pix)
+	sum := 0.0
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+	var sumB, best float64
+	weightB, threshold := 0, 127
+	for t, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(t * n)
+		meanB := sumB / float64(weightB)
+		meanF := (sum - sumB) / float64(weightF)
+		between := float64(weightB) * float64(weightF) * (meanB - meanF) * (meanB - meanF)
+		if between > best {
+			best, threshold = between, t
+		}
+	}
+	b := &bitmap{w: l.w, h: l.h, dark: make([]bool, len(l.pix))}
+	for i, v := range l.pix {
+		b.dark[i] = int(v) <= threshold
+	}
+	return b
+}
+
+// localThreshold сравнивает пиксель со средней яркостью окна вокруг него — для фото и градиентов.
+func localThreshold(l *luminance) *bitmap {
+	w, h := l.w, l.h
+	integral := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			row += int64(l.pix[y*w+x])
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + row
+		}
+	}
+	r := int(math.Max(8, float64(min(w, h))/8))
+	b := &bitmap{w: w, h: h, dark: make([]bool, len(l.pix))}
+	for y := 0; y < h; y++ {
+		y0, y1 := max(0, y-r), min(h, y+r+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(0, x-r), min(w, x+r+1)
+			sum := integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+			count := int64((y1 - y0) * (x1 - x0))
+			// Тёмный — заметно темнее среднего по окну (на 10%), чтобы шум на белом фоне не давал точек.
+			b.dark[y*w+x] = int64(l.pix[y*w+x])*count*10 < sum*9
+		}
+	}
+	return b
+}
+
+// decode ищет поисковые узоры и пробует прочитать код для самых правдоподобных троек.
+func (b *bitmap) decode() (string, error) {
+	for _, t := range bestTriples(b.findFinders()) {
+		t = b.measure(t)
+		tried := map[int]bool{}
+		for _, version := range t.versions() {
+			if version >= 7 {
+				if v, ok := b.sample(t.affine(version), version).readVersion(); ok {
+					version = v
+				}
+			}
+			if tried[version] {
+				continue
+			}
+			tried[version] = true
+			for _, p := range b.transforms(t, version) {
+				if text, err := b.sample(p, version).decode(); err == nil {
+					return text, nil
+				}
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// affine — преобразование координат модулей в пиксели по трём поисковым узорам:
+// их центры (3.5, 3.5), (dim-3.5, 3.5), (3.5, dim-3.5), четвёртый угол достраивается до параллелограмма.
+func (t triple) affine(version int) perspective {
+	dim := float64(17 + 4*version)
+	br := point{x: t.tr.x + t.bl.x - t.tl.x, y: t.tr.y + t.bl.y - t.tl.y}
+	p, _ := quadToQuad(
+		[4]point{{3.5, 3.5}, {dim - 3.5, 3.5}, {dim - 3.5, dim - 3.5}, {3.5, dim - 3.5}},
+		[4]point{{t.tl.x, t.tl.y}, {t.tr.x, t.tr.y}, br, {t.bl.x, t.bl.y}},
+	)
+	return p
+}
+
+// transforms — варианты преобразования для версии: перспективные по трём поисковым узорам и кандидатам
+// в нижний правый выравнивающий узор (центр (dim-6.5, dim-6.5)), последним — аффинное.
+// У версии 1 выравнивающего узора нет — вместо него перебираются точки вокруг аффинной оценки
+// (наклон камеры уводит нижний правый угол от неё на модуль-другой).
+func (b *bitmap) transforms(t triple, version int) []perspective {
+	affine := t.affine(version)
+	dim := float64(17 + 4*version)
+	ex, ey := affine.apply(dim-6.5, dim-6.5)
+	est := point{x: ex, y: ey}
+	var candidates []point
+	if version == 1 {
+		candidates = cornerGuesses(est, t.module)
+	} else {
+		candidates = b.findAlignments(est, t.module)
+	}
+	var out []perspective
+	for _, c := range candidates {
+		p, ok := quadToQuad(
+			[4]point{{3.5, 3.5}, {dim - 3.5, 3.5}, {dim - 6.5, dim - 6.5}, {3.5, dim - 3.5}},
+			[4]point{{t.tl.x, t.tl.y}, {t.tr.x, t.tr.y}, c, {t.bl.x, t.bl.y}},
+		)
+		if ok {
+			out = append(out, p)
+		}
+	}
+	if version == 1 {
+		return out // первая догадка — сама аффинная оценка
+	}
+	return append(out, affine)
+}
+
+// cornerGuesses — точки в пределах двух модулей от est с шагом в полмодуля, начиная с самой est.
+func cornerGuesses(est point, module float64) []point {
+	var out []point
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			out = append(out, point{x: est.x + float64(dx)*module/2, y: est.y + float64(dy)*module/2})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b point) int {
+		return cmp.Compare(math.Hypot(a.x-est.x, a.y-est.y), math.Hypot(b.x-est.x, b.y-est.y))
+	})
+	return out
+}
+
+// sample снимает модули с картинки: центр модуля (col+0.5, row+0.5) переводится в пиксели преобразованием p.
+func (b *bitmap) sample(p perspective, version int) *grid {
+	dim := 17 + 4*version
+	g := &grid{dim: dim, bits: make([]bool, dim*dim)}
+	for row := 0; row < dim; row++ {
+		for col := 0; col < dim; col++ {
+			px, py := p.apply(float64(col)+0.5, float64(row)+0.5)
+			x, y := int(math.Floor(px)), int(math.Floor(py))
+			if x >= 0 && y >= 0 && x < b.w && y < b.h {
+				g.bits[row*dim+col] = b.at(x, y)
+			}
+		}
+	}
+	return g
+}
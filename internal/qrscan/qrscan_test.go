@@ -0,0 +1,281 @@
+package qrscan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var levels = []struct {
+	name     string
+	level    int
+	recovery qrcode.RecoveryLevel
+}{
+	{"L", levelL, qrcode.Low},
+	{"M", levelM, qrcode.Medium},
+	{"Q", levelQ, qrcode.High},
+	{"H", levelH, qrcode.Highest},
+}
+
+// payload — текст в байтовом режиме на ~3/4 ёмкости версии и уровня из символов, встречающихся в ссылках.
+func payload(version, level int) string {
+	capacity := rawDataModules(version)/8 - eccPerBlock[level][version]*eccBlocks[level][version]
+	n := capacity*3/4 - 3
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789-_.~/?=&"
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = alphabet[(i*7+version*13+level)%len(alphabet)]
+	}
+	return string(buf)
+}
+
+// render рисует модули кода (с белой рамкой) в картинку w×h: квадрат модулей переводится в четырёхугольник dst.
+// Каждый пиксель усредняется по 2×2 точкам, чтобы края модулей были серыми, как у настоящего масштабирования.
+func render(t *testing.T, bits [][]bool, dst [4]point, w, h int) *image.Gray {
+	t.Helper()
+	n := float64(len(bits))
+	toImage, ok := quadToQuad([4]point{{0, 0}, {n, 0}, {n, n}, {0, n}}, dst)
+	if !ok {
+		t.Fatal("degenerate quad")
+	}
+	toModules, ok := toImage.inverse()
+	if !ok {
+		t.Fatal("degenerate transform")
+	}
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dark := 0
+			for sy := 0; sy < 2; sy++ {
+				for sx := 0; sx < 2; sx++ {
+					mx, my := toModules.apply(float64(x)+(float64(sx)+0.5)/2, float64(y)+(float64(sy)+0.5)/2)
+					c, r := int(math.Floor(mx)), int(math.Floor(my))
+					if r >= 0 && c >= 0 && r < len(bits) && c < len(bits) && bits[r][c] {
+						dark++
+					}
+				}
+			}
+			img.Pix[y*img.Stride+x] = uint8(255 - dark*255/4)
+		}
+	}
+	return img
+}
+
+// square — квадрат со стороной side, повёрнутый на angle градусов вокруг центра картинки size×size.
+func square(size, side, angle float64) [4]point {
+	a := angle * math.Pi / 180
+	var q [4]point
+	for i, c := range [4]point{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+		x, y := c.x*side/2, c.y*side/2
+		q[i] = point{x: size/2 + x*math.Cos(a) - y*math.Sin(a), y: size/2 + x*math.Sin(a) + y*math.Cos(a)}
+	}
+	return q
+}
+
+func encode(t *testing.T, text string, version int, recovery qrcode.RecoveryLevel) [][]bool {
+	t.Helper()
+	q, err := qrcode.NewWithForcedVersion(text, version, recovery)
+	if err != nil {
+		t.Fatalf("encode v%d: %v", version, err)
+	}
+	return q.Bitmap()
+}
+
+func expectDecode(t *testing.T, img image.Image, want string) {
+	t.Helper()
+	got, err := Decode(img)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got != want {
+		t.Fatalf("Decode = %q, want %q", got, want)
+	}
+}
+
+// Каждая версия с каждым уровнем коррекции, ровно и с дробным масштабом.
+func TestDecodeAllVersionsAndLevels(t *testing.T) {
+	for version := 1; version <= 40; version++ {
+		for _, l := range levels {
+			t.Run(fmt.Sprintf("v%d-%s", version, l.name), func(t *testing.T) {
+				t.Parallel()
+				text := payload(version, l.level)
+				bits := encode(t, text, version, l.recovery)
+				n := float64(len(bits))
+				for _, scale := range []float64{3, 2.6} {
+					size := int(math.Ceil(n * scale))
+					expectDecode(t, render(t, bits, square(float64(size), n*scale, 0), size, size), text)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeTransformed(t *testing.T) {
+	tests := []struct {
+		name string
+		quad func(size float64) [4]point
+	}{
+		{"rotated 90", func(s float64) [4]point { return square(s, s*0.8, 90) }},
+		{"rotated 180", func(s float64) [4]point { return square(s, s*0.8, 180) }},
+		{"rotated 17", func(s float64) [4]point { return square(s, s*0.65, 17) }},
+		{"rotated 45", func(s float64) [4]point { return square(s, s*0.65, 45) }},
+		{"rotated 300", func(s float64) [4]point { return square(s, s*0.65, 300) }},
+		// Наклон камеры: дальняя сторона кода на ~10% короче ближней.
+		{"tilted away", func(s float64) [4]point {
+			return [4]point{{s * 0.1, s * 0.08}, {s * 0.9, s * 0.08}, {s * 0.95, s * 0.92}, {s * 0.05, s * 0.92}}
+		}},
+		{"tilted sideways", func(s float64) [4]point {
+			return [4]point{{s * 0.06, s * 0.05}, {s * 0.92, s * 0.1}, {s * 0.92, s * 0.9}, {s * 0.06, s * 0.95}}
+		}},
+		{"tilted and rotated", func(s float64) [4]point {
+			return [4]point{{s * 0.18, s * 0.06}, {s * 0.94, s * 0.2}, {s * 0.82, s * 0.94}, {s * 0.06, s * 0.8}}
+		}},
+	}
+	for _, version := range []int{1, 2, 5, 7, 10, 15, 22} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("v%d %s", version, tt.name), func(t *testing.T) {
+				text := payload(version, levelM)
+				bits := encode(t, text, version, qrcode.Medium)
+				size := len(bits) * 6
+				expectDecode(t, render(t, bits, tt.quad(float64(size)), size, size), text)
+			})
+		}
+	}
+}
+
+func TestDecodeNoise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, version := range []int{1, 4, 10, 20} {
+		text := payload(version, levelQ)
+		bits := encode(t, text, version, qrcode.High)
+		size := len(bits) * 5
+		clean := render(t, bits, square(float64(size), float64(size)*0.9, 8), size, size)
+
+		t.Run(fmt.Sprintf("v%d gaussian", version), func(t *testing.T) {
+			img := image.NewGray(clean.Rect)
+			for i, v := range clean.Pix {
+				img.Pix[i] = clamp(float64(v) + rng.NormFloat64()*40)
+			}
+			expectDecode(t, img, text)
+		})
+		t.Run(fmt.Sprintf("v%d salt and pepper", version), func(t *testing.T) {
+			img := image.NewGray(clean.Rect)
+			copy(img.Pix, clean.Pix)
+			for i := range img.Pix {
+				switch r := rng.Float64(); {
+				case r < 0.02:
+					img.Pix[i] = 0
+				case r < 0.04:
+					img.Pix[i] = 255
+				}
+			}
+			expectDecode(t, img, text)
+		})
+		t.Run(fmt.Sprintf("v%d low contrast gradient", version), func(t *testing.T) {
+			img := image.NewGray(clean.Rect)
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					light := 120 + 120*float64(x+y)/float64(2*size)
+					v := float64(clean.Pix[y*clean.Stride+x]) / 255
+					img.Pix[y*img.Stride+x] = clamp(light * (0.55 + 0.45*v))
+				}
+			}
+			expectDecode(t, img, text)
+		})
+		t.Run(fmt.Sprintf("v%d jpeg", version), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, clean, &jpeg.Options{Quality: 40}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeBytes(buf.Bytes())
+			if err != nil || got != text {
+				t.Fatalf("DecodeBytes = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestDecodeInverted(t *testing.T) {
+	text := payload(3, levelM)
+	bits := encode(t, text, 3, qrcode.Medium)
+	size := len(bits) * 4
+	img := render(t, bits, square(float64(size), float64(size), 0), size, size)
+	for i, v := range img.Pix {
+		img.Pix[i] = 255 - v
+	}
+	expectDecode(t, img, text)
+}
+
+func TestDecodeNotFound(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	noise := image.NewGray(image.Rect(0, 0, 300, 300))
+	for i := range noise.Pix {
+		noise.Pix[i] = uint8(rng.IntN(256))
+	}
+	blocks := image.NewGray(image.Rect(0, 0, 300, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			if (x/12+y/12)%3 == 0 {
+				blocks.Pix[y*300+x] = 0
+			} else {
+				blocks.Pix[y*300+x] = 255
+			}
+		}
+	}
+	blank := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	// Код с затёртой серединой: узоры на месте, данных не восстановить.
+	text := payload(5, levelL)
+	bits := encode(t, text, 5, qrcode.Low)
+	size := len(bits) * 4
+	damaged := render(t, bits, square(float64(size), float64(size), 0), size, size)
+	for y := size / 4; y < size*3/4; y++ {
+		for x := size / 4; x < size*3/4; x++ {
+			damaged.Pix[y*damaged.Stride+x] = uint8((x * y) % 2 * 255)
+		}
+	}
+
+	for name, img := range map[string]image.Image{
+		"noise": noise, "checkerboard": blocks, "blank": blank, "damaged code": damaged,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got, err := Decode(img); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Decode = %q, %v; want ErrNotFound", got, err)
+			}
+		})
+	}
+
+	t.Run("not an image", func(t *testing.T) {
+		if _, err := DecodeBytes([]byte("vless://not-an-image")); err == nil {
+			t.Error("DecodeBytes: expected error")
+		}
+	})
+	t.Run("png without code", func(t *testing.T) {
+		var buf bytes.Buffer
+		img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+		for i := 0; i < 40; i++ {
+			img.Set(i, i, color.Black)
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeBytes(buf.Bytes()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DecodeBytes: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,147 @@
+package qrscan
+
+// Арифметика GF(256) с порождающим многочленом x^8+x^4+x^3+x^2+1 (0x11D), как в QR.
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])*n%255]
+}
+
+// rsCorrect исправляет ошибки в блоке (данные + eccLen байт коррекции) на месте:
+// синдромы, Берлекэмп–Мэсси, поиск Ченя и формула Форни. Первый корень генератора — α^0.
+func rsCorrect(block []byte, eccLen int) error {
+	n := len(block)
+	syndromes := rsSyndromes(block, eccLen)
+	if syndromes == nil {
+		return nil
+	}
+
+	// locator — многочлен локаторов ошибок Λ(x), коэффициенты по возрастанию степени.
+	locator, prev := []byte{1}, []byte{1}
+	errs, shift, lastDiscrepancy := 0, 1, byte(1)
+	for k := 0; k < eccLen; k++ {
+		d := syndromes[k]
+		for i := 1; i <= errs && i < len(locator); i++ {
+			d ^= gfMul(locator[i], syndromes[k-i])
+		}
+		if d == 0 {
+			shift++
+			continue
+		}
+		saved := append([]byte(nil), locator...)
+		if need := len(prev) + shift; len(locator) < need {
+			locator = append(locator, make([]byte, need-len(locator))...)
+		}
+		coef := gfDiv(d, lastDiscrepancy)
+		for i, c := range prev {
+			locator[i+shift] ^= gfMul(coef, c)
+		}
+		if 2*errs <= k {
+			errs, prev, lastDiscrepancy, shift = k+1-errs, saved, d, 1
+		} else {
+			shift++
+		}
+	}
+	if 2*errs > eccLen {
+		return errChecksum
+	}
+
+	// Позиции ошибок — степени p, для которых Λ(α^-p) = 0; байт block[n-1-p].
+	var positions []int
+	for p := 0; p < n; p++ {
+		if rsEval(locator, gfExp[(255-p%255)%255]) == 0 {
+			positions = append(positions, p)
+		}
+	}
+	if len(positions) != errs {
+		return errChecksum
+	}
+
+	// Ω(x) = S(x)·Λ(x) mod x^eccLen.
+	omega := make([]byte, eccLen)
+	for i := range omega {
+		for j := 0; j <= i && j < len(locator); j++ {
+			omega[i] ^= gfMul(locator[j], syndromes[i-j])
+		}
+	}
+	for _, p := range positions {
+		xInv := gfExp[(255-p%255)%255]
+		var derivative byte
+		for i := 1; i < len(locator); i += 2 {
+			derivative ^= gfMul(locator[i], gfPow(xInv, i-1))
+		}
+		if derivative == 0 {
+			return errChecksum
+		}
+		block[n-1-p] ^= gfMul(gfExp[p%255], gfDiv(rsEval(omega, xInv), derivative))
+	}
+	if rsSyndromes(block, eccLen) != nil {
+		return errChecksum
+	}
+	return nil
+}
+
+// rsSyndromes — значения блока в α^0..α^(eccLen-1); nil, если все нулевые (ошибок нет).
+func rsSyndromes(block []byte, eccLen int) []byte {
+	syndromes := make([]byte, eccLen)
+	clean := true
+	for i := range syndromes {
+		var s byte
+		for _, c := range block {
+			s = gfMul(s, gfExp[i]) ^ c
+		}
+		syndromes[i] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return nil
+	}
+	return syndromes
+}
+
+// rsEval вычисляет многочлен (коэффициенты по возрастанию степени) в точке x.
+func rsEval(poly []byte, x byte) byte {
+	var v byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		v = gfMul(v, x) ^ poly[i]
+	}
+	return v
+}
@@ -3,7 +3,12 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	coreserver "github.com/GalitskyKK/nekkus-core/pkg/server"
@@ -12,10 +17,76 @@ import (
 	"github.com/GalitskyKK/nekkus-net/internal/vpn"
 )
 
+// configView — подписка в формате VpnConfig фронтенда. Локальные конфиги отдают своё содержимое,
+// у удалённых подписок content пустой, а source_url — URL подписки.
+func configView(sub store.Subscription) map[string]interface{} {
+	sourceURL := sub.URL
+	if sourceURL == "" {
+		sourceURL = sub.SourceURL
+	}
+	return map[string]interface{}{
+		"id":              sub.ID,
+		"name":            sub.Name,
+		"content":         sub.Content,
+		"source_url":      sourceURL,
+		"subscription_id": sub.ID,
+		"created_at":      sub.UpdatedAt,
+		"updated_at":      sub.UpdatedAt,
+	}
+}
+
+// subscriptionView — подписка для API без секретов запроса: пароль basic auth, заголовки (HWID, токены)
+// и учётные данные прокси не отдаются. Вместо них — признаки has_auth/has_proxy и имена заголовков;
+// fetch_proxy — без user:password.
+type subscriptionView struct {
+	store.Subscription
+	HasAuth     bool     `json:"has_auth"`
+	HasProxy    bool     `json:"has_proxy"`
+	HeaderNames []string `json:"header_names,omitempty"`
+}
+
+func newSubscriptionView(sub store.Subscription) subscriptionView {
+	v := subscriptionView{
+		Subscription: sub,
+		HasAuth:      sub.AuthUser != "" || sub.AuthPassword != "",
+		HasProxy:     sub.FetchProxy != "",
+	}
+	for name := range sub.Headers {
+		v.HeaderNames = append(v.HeaderNames, name)
+	}
+	sort.Strings(v.HeaderNames)
+	v.AuthPassword, v.Headers = "", nil
+	if u, err := url.Parse(sub.FetchProxy); err == nil && u.Host != "" {
+		u.User = nil
+		v.FetchProxy = u.String()
+	} else {
+		v.FetchProxy = ""
+	}
+	return v
+}
+
+// errorStatus — HTTP-код ошибки движка: не найдено — 404, отклонённый ввод — 400,
+// сервер нужен другим серверам (detour) — 409, остальное — 500.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrSubscriptionNotFound), errors.Is(err, store.ErrServerNotFound):
+		return 404
+	case errors.Is(err, vpn.ErrInvalidInput):
+		return 400
+	case errors.Is(err, vpn.ErrServerInUse):
+		return 409
+	}
+	return 500
+}
+
+// maxQRImageSize — предел размера картинки для POST /api/import/qr.
+const maxQRImageSize = 10 << 20
+
 func setCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Export-Skipped")
 }
 
 func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
@@ -76,6 +147,7 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"connected":             connected,
 			"server":                serverName,
+			"serverRemoved":         connected && engine.CurrentServerRemoved(),
 			"servers":               serversList,
 			"activeConfigId":        "",
 			"configCount":           0,
@@ -97,6 +169,20 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		// ?country=DE,NL — только серверы этих стран (ISO-коды, регистр не важен).
+		if countries := r.URL.Query().Get("country"); countries != "" {
+			want := make(map[string]bool)
+			for _, c := range strings.Split(countries, ",") {
+				want[strings.ToUpper(strings.TrimSpace(c))] = true
+			}
+			filtered := make([]store.ServerNode, 0, len(servers))
+			for _, s := range servers {
+				if want[s.Country] {
+					filtered = append(filtered, s)
+				}
+			}
+			servers = filtered
+		}
 		if servers == nil {
 			servers = []store.ServerNode{}
 		}
@@ -104,6 +190,151 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 		json.NewEncoder(w).Encode(servers)
 	})
 
+	srv.Mux.HandleFunc("POST /api/servers", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		var req vpn.ManualServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		node, err := engine.AddManualServer(req)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(node)
+	})
+
+	srv.Mux.HandleFunc("PUT /api/servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		var req vpn.ManualServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		node, err := engine.UpdateManualServer(id, req)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(node)
+	})
+
+	srv.Mux.HandleFunc("DELETE /api/servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		if err := engine.DeleteManualServer(id); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Замер задержки: тело {"ids": [...], "mode": "tcp"|"url", "url": "..."} необязательно (пусто — все серверы, tcp).
+	// Результаты отдаются NDJSON по одному, по мере готовности.
+	srv.Mux.HandleFunc("POST /api/servers/ping", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		var req vpn.PingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		started := false
+		start := func() {
+			if !started {
+				started = true
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.WriteHeader(http.StatusOK)
+			}
+		}
+		err := engine.PingServers(r.Context(), req, func(res vpn.PingResult) {
+			start()
+			enc.Encode(res)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		})
+		if err != nil && !started && r.Context().Err() == nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		start()
+	})
+
+	// Ссылка на сервер и её QR-код; ?format=png — только картинка.
+	srv.Mux.HandleFunc("GET /api/servers/{id}/share", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		share, err := engine.ShareServer(id)
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if r.URL.Query().Get("format") == "png" {
+			png, err := vpn.ServerQRCode(share.URI)
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(share)
+	})
+
+	// Импорт из картинки с QR-кодом: multipart (поле image, необязательное name) или сама картинка в теле.
+	srv.Mux.HandleFunc("POST /api/import/qr", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		r.Body = http.MaxBytesReader(w, r.Body, maxQRImageSize)
+		name := r.URL.Query().Get("name")
+		var image []byte
+		var err error
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			file, _, ferr := r.FormFile("image")
+			if ferr != nil {
+				http.Error(w, "image required", 400)
+				return
+			}
+			defer file.Close()
+			image, err = io.ReadAll(file)
+			if v := r.FormValue("name"); v != "" {
+				name = v
+			}
+		} else {
+			image, err = io.ReadAll(r.Body)
+		}
+		if err != nil || len(image) == 0 {
+			http.Error(w, "image required", 400)
+			return
+		}
+		result, err := engine.ImportQR(image, name)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
 	srv.Mux.HandleFunc("POST /api/connect", func(w http.ResponseWriter, r *http.Request) {
 		setCORS(w)
 		var req struct {
@@ -211,8 +442,12 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 			http.Error(w, err.Error(), 500)
 			return
 		}
+		views := make([]subscriptionView, 0, len(subs))
+		for _, sub := range subs {
+			views = append(views, newSubscriptionView(sub))
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(subs)
+		json.NewEncoder(w).Encode(views)
 	})
 
 	srv.Mux.HandleFunc("GET /api/traffic", func(w http.ResponseWriter, r *http.Request) {
@@ -235,20 +470,67 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 		}
 		configs := make([]map[string]interface{}, 0, len(subs))
 		for _, sub := range subs {
-			configs = append(configs, map[string]interface{}{
-				"id":               sub.ID,
-				"name":             sub.Name,
-				"content":          "",
-				"source_url":       sub.URL,
-				"subscription_id":  sub.ID,
-				"created_at":       sub.UpdatedAt,
-				"updated_at":       sub.UpdatedAt,
-			})
+			configs = append(configs, configView(sub))
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(configs)
 	})
 
+	srv.Mux.HandleFunc("POST /api/configs", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		var req vpn.ConfigRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		sub, err := engine.AddConfig(req)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(configView(*sub))
+	})
+
+	srv.Mux.HandleFunc("PUT /api/configs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		var req vpn.ConfigRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		sub, diff, err := engine.UpdateConfig(id, req)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		view := configView(*sub)
+		if diff != nil {
+			view["diff"] = diff
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+	})
+
+	srv.Mux.HandleFunc("DELETE /api/configs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		if err := engine.DeleteConfig(id); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
 	srv.Mux.HandleFunc("GET /api/settings", func(w http.ResponseWriter, _ *http.Request) {
 		setCORS(w)
 		settings, err := engine.GetSettings()
@@ -268,6 +550,10 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 			return
 		}
 		settings, err := engine.UpdateSettings(patch)
+		if errors.Is(err, vpn.ErrInvalidInput) {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), 500)
 			return
@@ -300,12 +586,105 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 			http.Error(w, "id required", 400)
 			return
 		}
-		if err := engine.RefreshSubscription(id); err != nil {
-			http.Error(w, err.Error(), 500)
+		diff, err := engine.RefreshSubscription(id)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "ok"})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":                     id,
+			"status":                 "ok",
+			"diff":                   diff,
+			"current_server_removed": engine.CurrentServerRemoved(),
+		})
+	})
+
+	srv.Mux.HandleFunc("GET /api/subscriptions/{id}/report", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		report, err := engine.GetSubscriptionReport(id)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	srv.Mux.HandleFunc("GET /api/subscriptions/{id}/export", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", vpn.ExportURI, vpn.ExportBase64, vpn.ExportClash, vpn.ExportSingBox:
+		default:
+			http.Error(w, "format must be uri, base64, clash or singbox", 400)
+			return
+		}
+		body, contentType, skipped, err := engine.ExportSubscription(id, format)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		// Пропущенные узлы — в заголовке (JSON в percent-encoding): тело остаётся чистым файлом подписки.
+		if len(skipped) > 0 {
+			if data, err := json.Marshal(skipped); err == nil {
+				w.Header().Set("X-Export-Skipped", url.PathEscape(string(data)))
+			}
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	})
+
+	srv.Mux.HandleFunc("POST /api/subscriptions/{id}/rules/preview", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		var rules store.SubscriptionRules
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		preview, err := engine.PreviewSubscriptionRules(id, rules)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preview)
+	})
+
+	srv.Mux.HandleFunc("PUT /api/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		id := r.PathValue("id")
+		if id == "" {
+			http.Error(w, "id required", 400)
+			return
+		}
+		var patch vpn.SubscriptionPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "invalid request", 400)
+			return
+		}
+		sub, err := engine.UpdateSubscription(id, patch)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newSubscriptionView(*sub))
 	})
 
 	srv.Mux.HandleFunc("DELETE /api/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
@@ -316,7 +695,7 @@ func RegisterRoutes(srv *coreserver.Server, engine *vpn.Engine) {
 			return
 		}
 		if err := engine.DeleteSubscription(id); err != nil {
-			http.Error(w, err.Error(), 404)
+			http.Error(w, err.Error(), errorStatus(err))
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -2,6 +2,7 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,9 +11,16 @@ import (
 	"time"
 )
 
+// Ошибки поиска по ID: обёртки с самим ID проверяются через errors.Is (API отвечает на них 404).
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrServerNotFound       = errors.New("server not found")
+)
+
 const subscriptionsFile = "subscriptions.json"
 const settingsFile = "settings.json"
 const trafficStatsFile = "traffic_stats.json"
+const serversFile = "servers.json"
 
 type Settings struct {
 	// SingBoxPath — полный путь до sing-box (например, C:\Tools\sing-box\sing-box.exe).
@@ -26,6 +34,44 @@ type Settings struct {
 	// LastConnectedServerID — последний успешно подключённый сервер (ID или Name).
 	// При старте из Hub модуль подключается к нему автоматически.
 	LastConnectedServerID string `json:"last_connected_server_id,omitempty"`
+
+	// SubscriptionRefreshMinutes — общий интервал автообновления подписок.
+	// nil — брать profile-update-interval провайдера (или 12 ч), <0 — автообновление выключено.
+	// В патче UpdateSettings указатель на 0 снимает общий интервал.
+	SubscriptionRefreshMinutes *int `json:"subscription_refresh_minutes,omitempty"`
+
+	// UTLSFingerprint — отпечаток uTLS (chrome, firefox, safari…) для vless/vmess/trojan с TLS,
+	// если ссылка не задаёт свой fp. Пусто или "none" — без uTLS (Reality всё равно получит chrome).
+	UTLSFingerprint string `json:"utls_fingerprint,omitempty"`
+}
+
+// Способы загрузки подписки (Subscription.FetchVia). Пустое значение — как FetchViaDirect.
+const (
+	// FetchViaDirect — напрямую; при ошибке и подключённом VPN — повтор через туннель.
+	FetchViaDirect = "direct"
+	// FetchViaTunnel — только через mixed inbound запущенного sing-box.
+	FetchViaTunnel = "tunnel"
+	// FetchViaProxy — через явный SOCKS5/HTTP прокси из FetchProxy.
+	FetchViaProxy = "proxy"
+)
+
+// FilterRule — регулярное выражение по одному полю узла.
+// Field: "name" (по умолчанию), "host", "protocol" или "country" (ISO-код, например "DE").
+type FilterRule struct {
+	Field   string `json:"field,omitempty"`
+	Pattern string `json:"pattern"`
+}
+
+// SubscriptionRules — фильтры и переименование узлов подписки, применяются при каждом обновлении.
+type SubscriptionRules struct {
+	// Include — оставить только узлы, подходящие хотя бы под одно правило (пусто — все).
+	Include []FilterRule `json:"include,omitempty"`
+	// Exclude — убрать узлы, подходящие хотя бы под одно правило (например, «трафик»/«истекает»).
+	Exclude []FilterRule `json:"exclude,omitempty"`
+	// Rename — шаблон имени: {name}, {host}, {protocol}, {country}, {index}. Пусто — имя от провайдера.
+	Rename string `json:"rename,omitempty"`
+	// Prefix — добавляется перед именем после переименования.
+	Prefix string `json:"prefix,omitempty"`
 }
 
 // Subscription и ServerNode — типы для VPN (используются engine и API).
@@ -34,8 +80,15 @@ type ServerNode struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
 	Country string `json:"country"`
-	Ping    int    `json:"ping"`
-	URI     string `json:"uri,omitempty"`
+	// Ping — последняя измеренная задержка, мс; 0 — не измерялась, -1 — сервер не ответил.
+	Ping int `json:"ping"`
+	// PingedAt — когда измерена Ping (Unix).
+	PingedAt int64  `json:"pinged_at,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	// Outbound — готовый sing-box outbound для узлов из структурированных источников (Clash YAML, sing-box JSON)
+	// или заданный вручную. Если задан, используется вместо URI: так не теряются поля, которых нет в share-ссылках.
+	// detour в нём — ID другого сохранённого сервера (цепочка) или вложенный outbound (ShadowTLS).
+	Outbound map[string]any `json:"outbound,omitempty"`
 }
 
 type Subscription struct {
@@ -45,6 +98,44 @@ type Subscription struct {
 	Servers   []ServerNode `json:"servers"`
 	UpdatedAt int64        `json:"updated_at"`
 	ExpiresAt int64        `json:"expires_at,omitempty"` // Unix; 0 = неизвестно (опционально из заголовков подписки)
+
+	// Content — тело локального конфига (вставленные ссылки, base64, Clash YAML, sing-box JSON).
+	// У таких подписок URL пустой: серверы берутся из Content, а не загружаются.
+	Content string `json:"content,omitempty"`
+	// SourceURL — откуда пользователь взял конфиг (только для справки, не загружается).
+	SourceURL string `json:"source_url,omitempty"`
+
+	// Трафик из subscription-userinfo, байты; Total = 0 — безлимит или провайдер не сообщил.
+	Upload   int64 `json:"upload,omitempty"`
+	Download int64 `json:"download,omitempty"`
+	Total    int64 `json:"total,omitempty"`
+	// ProfileTitle, UpdateInterval (часы), WebPageURL — из заголовков profile-*.
+	ProfileTitle   string `json:"profile_title,omitempty"`
+	UpdateInterval int    `json:"update_interval,omitempty"`
+	WebPageURL     string `json:"web_page_url,omitempty"`
+
+	// Параметры запроса подписки: свой User-Agent, заголовки (например, x-hwid) и basic auth.
+	UserAgent    string            `json:"user_agent,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	AuthUser     string            `json:"auth_user,omitempty"`
+	AuthPassword string            `json:"auth_password,omitempty"`
+	// FetchVia — как загружать подписку (FetchVia*); FetchProxy — URL прокси для FetchViaProxy.
+	FetchVia   string `json:"fetch_via,omitempty"`
+	FetchProxy string `json:"fetch_proxy,omitempty"`
+	// Rules — фильтры и переименование узлов; nil — список как у провайдера.
+	Rules *SubscriptionRules `json:"rules,omitempty"`
+	// ETag/LastModified прошлого ответа — для условного запроса (304 = список не изменился).
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// RefreshMinutes — интервал автообновления этой подписки; 0 — из настроек/провайдера, <0 — не обновлять.
+	RefreshMinutes int `json:"refresh_minutes,omitempty"`
+	// Исход последних обновлений (Unix). FailCount — ошибок подряд, от него зависит backoff.
+	LastSuccess   int64  `json:"last_success,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorAt   int64  `json:"last_error_at,omitempty"`
+	FailCount     int    `json:"fail_count,omitempty"`
+	NextRefreshAt int64  `json:"next_refresh_at,omitempty"`
 }
 
 // TotalTrafficStats — накопленный трафик за всё время (сессии суммируются).
@@ -78,6 +169,9 @@ func New(dataDir string) (*Store, error) {
 	if err := s.loadTotalTraffic(); err != nil {
 		return nil, err
 	}
+	if err := s.loadServers(); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
@@ -188,6 +282,15 @@ func (s *Store) UpdateSettings(patch Settings) (Settings, error) {
 	if patch.LastConnectedServerID != "" {
 		next.LastConnectedServerID = patch.LastConnectedServerID
 	}
+	if patch.SubscriptionRefreshMinutes != nil {
+		next.SubscriptionRefreshMinutes = nil
+		if minutes := *patch.SubscriptionRefreshMinutes; minutes != 0 {
+			next.SubscriptionRefreshMinutes = &minutes
+		}
+	}
+	if patch.UTLSFingerprint != "" {
+		next.UTLSFingerprint = patch.UTLSFingerprint
+	}
 	if err := s.saveSettings(next); err != nil {
 		return Settings{}, err
 	}
@@ -224,7 +327,7 @@ func (s *Store) GetSubscription(id string) (*Subscription, error) {
 			return &sub, nil
 		}
 	}
-	return nil, fmt.Errorf("subscription not found: %s", id)
+	return nil, fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
 }
 
 func (s *Store) UpdateSubscriptionServers(id string, servers []ServerNode) error {
@@ -239,7 +342,25 @@ func (s *Store) UpdateSubscriptionServers(id string, servers []ServerNode) error
 	}
 	s.mu.Unlock()
 	if !found {
-		return fmt.Errorf("subscription not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+	}
+	return s.saveSubscriptions()
+}
+
+// UpdateSubscription применяет update к подписке с данным id под блокировкой и сохраняет список.
+func (s *Store) UpdateSubscription(id string, update func(*Subscription)) error {
+	s.mu.Lock()
+	var found bool
+	for i := range s.subscriptions {
+		if s.subscriptions[i].ID == id {
+			update(&s.subscriptions[i])
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
 	}
 	return s.saveSubscriptions()
 }
@@ -255,17 +376,16 @@ func (s *Store) GetSubscriptions() ([]Subscription, error) {
 	return result, nil
 }
 
-// GetServers возвращает все серверы: из плоского списка s.servers (если есть) или из всех подписок.
+// GetServers возвращает все серверы: добавленные вручную, затем из всех подписок.
 func (s *Store) GetServers() ([]ServerNode, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if len(s.servers) > 0 {
-		result := make([]ServerNode, len(s.servers))
-		copy(result, s.servers)
-		return result, nil
-	}
 	var result []ServerNode
 	seen := make(map[string]bool)
+	for _, n := range s.servers {
+		seen[n.ID] = true
+		result = append(result, n)
+	}
 	for _, sub := range s.subscriptions {
 		for _, n := range sub.Servers {
 			if n.ID != "" && !seen[n.ID] {
@@ -281,7 +401,7 @@ func (s *Store) GetServer(serverID string) (*ServerNode, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for i := range s.servers {
-		if s.servers[i].ID == serverID {
+		if s.servers[i].ID == serverID || s.servers[i].Name == serverID {
 			n := s.servers[i]
 			return &n, nil
 		}
@@ -294,7 +414,137 @@ func (s *Store) GetServer(serverID string) (*ServerNode, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf("server not found: %s", serverID)
+	return nil, fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+}
+
+func (s *Store) loadServers() error {
+	path := filepath.Join(s.dataDir, serversFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var list []ServerNode
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.servers = list
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) writeServers(list []ServerNode) error {
+	path := filepath.Join(s.dataDir, serversFile)
+	if err := os.MkdirAll(s.dataDir, 0750); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// UpdatePings записывает результаты замера задержки (ID узла → мс, -1 — не ответил) с меткой времени at
+// во все узлы с этими ID — ручные и из подписок — и сохраняет оба списка.
+func (s *Store) UpdatePings(pings map[string]int, at int64) error {
+	s.mu.Lock()
+	for i := range s.servers {
+		if ping, ok := pings[s.servers[i].ID]; ok {
+			s.servers[i].Ping, s.servers[i].PingedAt = ping, at
+		}
+	}
+	// Серверы подписок делят массив с копиями из GetSubscriptions — пишем в новый список, как UpdateSubscriptionServers.
+	for i := range s.subscriptions {
+		var servers []ServerNode
+		for j, n := range s.subscriptions[i].Servers {
+			ping, ok := pings[n.ID]
+			if !ok {
+				continue
+			}
+			if servers == nil {
+				servers = make([]ServerNode, len(s.subscriptions[i].Servers))
+				copy(servers, s.subscriptions[i].Servers)
+			}
+			servers[j].Ping, servers[j].PingedAt = ping, at
+		}
+		if servers != nil {
+			s.subscriptions[i].Servers = servers
+		}
+	}
+	list := make([]ServerNode, len(s.servers))
+	copy(list, s.servers)
+	s.mu.Unlock()
+	if err := s.writeServers(list); err != nil {
+		return err
+	}
+	return s.saveSubscriptions()
+}
+
+// GetManualServers возвращает серверы, добавленные вручную.
+func (s *Store) GetManualServers() ([]ServerNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]ServerNode, len(s.servers))
+	copy(result, s.servers)
+	return result, nil
+}
+
+// AddServer сохраняет сервер, добавленный вручную.
+func (s *Store) AddServer(node ServerNode) error {
+	s.mu.Lock()
+	for _, n := range s.servers {
+		if n.ID == node.ID {
+			s.mu.Unlock()
+			return fmt.Errorf("server already exists: %s", node.ID)
+		}
+	}
+	s.servers = append(s.servers, node)
+	list := make([]ServerNode, len(s.servers))
+	copy(list, s.servers)
+	s.mu.Unlock()
+	return s.writeServers(list)
+}
+
+// UpdateServer заменяет сервер, добавленный вручную (ID не меняется).
+func (s *Store) UpdateServer(node ServerNode) error {
+	s.mu.Lock()
+	found := false
+	for i := range s.servers {
+		if s.servers[i].ID == node.ID {
+			s.servers[i] = node
+			found = true
+			break
+		}
+	}
+	list := make([]ServerNode, len(s.servers))
+	copy(list, s.servers)
+	s.mu.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, node.ID)
+	}
+	return s.writeServers(list)
+}
+
+// DeleteServer удаляет сервер, добавленный вручную.
+func (s *Store) DeleteServer(id string) error {
+	s.mu.Lock()
+	var list []ServerNode
+	for _, n := range s.servers {
+		if n.ID != id {
+			list = append(list, n)
+		}
+	}
+	found := len(list) < len(s.servers)
+	s.servers = list
+	s.mu.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, id)
+	}
+	return s.writeServers(list)
 }
 
 func (s *Store) loadTotalTraffic() error {
@@ -361,7 +611,7 @@ func (s *Store) DeleteSubscription(id string) error {
 	s.subscriptions = list
 	s.mu.Unlock()
 	if !found {
-		return fmt.Errorf("subscription not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
 	}
 	return s.writeSubscriptions(list)
 }
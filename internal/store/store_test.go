@@ -0,0 +1,52 @@
+package store
+
+import (
+	"sync"
+	"testing"
+)
+
+// Снимок подписки из GetSubscriptions не меняется задним числом, когда UpdatePings пишет новые замеры
+// (go test -race ловит общую запись в массив серверов).
+func TestUpdatePingsKeepsSnapshots(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := s.AddSubscription("test", "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateSubscriptionServers(sub.ID, []ServerNode{{ID: "a", Ping: 10}, {ID: "b", Ping: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.GetSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := s.UpdatePings(map[string]int{"a": 100 + i}, int64(i)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if p := before[0].Servers[0].Ping; p != 10 {
+			t.Fatalf("snapshot ping changed to %d", p)
+		}
+	}
+	wg.Wait()
+
+	after, err := s.GetSubscription(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := after.Servers[0], after.Servers[1]; a.Ping != 149 || a.PingedAt != 49 || b.Ping != 20 {
+		t.Errorf("servers after UpdatePings = %+v", after.Servers)
+	}
+}
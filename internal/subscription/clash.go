@@ -0,0 +1,588 @@
+package subscription
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// isClashYAML — похоже ли тело на Clash/Mihomo конфиг (ключ proxies: на верхнем уровне).
+func isClashYAML(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimRight(line, "\r "), "proxies:") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClashYAML разбирает Clash/Mihomo YAML и превращает каждый прокси из proxies: в узел
+// с готовым sing-box outbound (без промежуточной share-ссылки). Неподдерживаемые типы пропускаются.
+// Номер строки в отчёте — номер элемента proxies.
+func parseClashYAML(content string, rep *Report) ([]store.ServerNode, error) {
+	var doc struct {
+		Proxies []map[string]any `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("clash yaml: %w", err)
+	}
+	out := make([]store.ServerNode, 0, len(doc.Proxies))
+	for i, p := range doc.Proxies {
+		outbound, err := clashProxyToOutbound(p)
+		if err != nil {
+			rep.add(i+1, yamlString(p, "name"), -1, err)
+			continue
+		}
+		rep.add(i+1, yamlString(p, "name"), len(out), nil)
+		out = append(out, store.ServerNode{
+			Name:     yamlString(p, "name"),
+			Address:  yamlString(p, "server"),
+			Outbound: outbound,
+		})
+	}
+	return out, nil
+}
+
+// clashProxyToOutbound переводит один элемент proxies: в sing-box outbound (для wireguard — endpoint).
+func clashProxyToOutbound(p map[string]any) (map[string]any, error) {
+	server := yamlString(p, "server")
+	port := yamlInt(p, "port")
+	if server == "" {
+		return nil, fmt.Errorf("clash: missing server")
+	}
+	typ := strings.ToLower(yamlString(p, "type"))
+	// Без порта узел ушёл бы в sing-box с server_port 0; порт по умолчанию есть только у hysteria2 (443) и wireguard (51820).
+	if port < 0 || port > 65535 || (port == 0 && typ != "hysteria2" && typ != "hy2" && typ != "wireguard") {
+		return nil, fmt.Errorf("clash: %s: missing or invalid port: %v", typ, p["port"])
+	}
+	switch typ {
+	case "ss":
+		return clashShadowsocks(p, server, port)
+	case "vmess":
+		out := map[string]any{
+			"type":        "vmess",
+			"server":      server,
+			"server_port": port,
+			"uuid":        yamlString(p, "uuid"),
+			"security":    "auto",
+			"alter_id":    yamlInt(p, "alterId"),
+		}
+		if cipher := yamlString(p, "cipher"); cipher != "" {
+			out["security"] = cipher
+		}
+		if out["uuid"] == "" {
+			return nil, fmt.Errorf("vmess: missing uuid")
+		}
+		if tls := clashTLS(p, yamlBool(p, "tls"), server); tls != nil {
+			out["tls"] = tls
+		}
+		return clashWithTransport(p, out)
+	case "vless":
+		out := map[string]any{
+			"type":        "vless",
+			"server":      server,
+			"server_port": port,
+			"uuid":        yamlString(p, "uuid"),
+		}
+		if out["uuid"] == "" {
+			return nil, fmt.Errorf("vless: missing uuid")
+		}
+		if flow := yamlString(p, "flow"); flow != "" {
+			out["flow"] = flow
+		}
+		if tls := clashTLS(p, yamlBool(p, "tls"), server); tls != nil {
+			out["tls"] = tls
+		}
+		return clashWithTransport(p, out)
+	case "trojan":
+		out := map[string]any{
+			"type":        "trojan",
+			"server":      server,
+			"server_port": port,
+			"password":    yamlString(p, "password"),
+			"tls":         clashTLS(p, true, server),
+		}
+		if out["password"] == "" {
+			return nil, fmt.Errorf("trojan: missing password")
+		}
+		return clashWithTransport(p, out)
+	case "hysteria2", "hy2":
+		out := map[string]any{
+			"type":        "hysteria2",
+			"server":      server,
+			"server_port": port,
+			"tls":         clashTLS(p, true, server),
+		}
+		if pw := yamlString(p, "password"); pw != "" {
+			out["password"] = pw
+		}
+		// ports — диапазоны для port hopping ("20000-30000,443"); основной порт добавляется в server_ports.
+		if ports := SplitList(yamlString(p, "ports")); len(ports) > 0 {
+			var ranges []string
+			for _, r := range ports {
+				if !strings.Contains(r, "-") {
+					r += "-" + r
+				}
+				ranges = append(ranges, strings.Replace(r, "-", ":", 1))
+			}
+			if port == 0 {
+				// Как у hy2:// ссылки: без port основным становится начало первого диапазона.
+				first, _, _ := strings.Cut(ranges[0], ":")
+				port, _ = strconv.Atoi(first)
+				out["server_port"] = port
+			}
+			out["server_ports"] = Hysteria2ServerPorts(port, ranges)
+		}
+		if up := parseClashMbps(yamlString(p, "up")); up > 0 {
+			out["up_mbps"] = up
+		}
+		if down := parseClashMbps(yamlString(p, "down")); down > 0 {
+			out["down_mbps"] = down
+		}
+		if obfs := yamlString(p, "obfs"); obfs != "" {
+			out["obfs"] = map[string]any{"type": obfs, "password": yamlString(p, "obfs-password")}
+		}
+		if port == 0 {
+			out["server_port"] = 443
+		}
+		return out, nil
+	case "tuic":
+		out := map[string]any{
+			"type":        "tuic",
+			"server":      server,
+			"server_port": port,
+			"uuid":        yamlString(p, "uuid"),
+			"password":    yamlString(p, "password"),
+		}
+		if out["uuid"] == "" {
+			return nil, fmt.Errorf("tuic: missing uuid")
+		}
+		if out["password"] == "" {
+			return nil, fmt.Errorf("tuic: missing password")
+		}
+		if cc := yamlString(p, "congestion-controller"); cc != "" {
+			out["congestion_control"] = cc
+		}
+		if mode := yamlString(p, "udp-relay-mode"); mode != "" {
+			out["udp_relay_mode"] = mode
+		}
+		if yamlBool(p, "reduce-rtt") {
+			out["zero_rtt_handshake"] = true
+		}
+		if hb := yamlInt(p, "heartbeat-interval"); hb > 0 {
+			out["heartbeat"] = strconv.Itoa(hb) + "ms"
+		}
+		tls := clashTLS(p, true, server)
+		if yamlBool(p, "disable-sni") {
+			tls["disable_sni"] = true
+		}
+		out["tls"] = tls
+		return out, nil
+	case "wireguard":
+		return clashWireGuard(p, server, port)
+	case "socks5":
+		if yamlBool(p, "tls") {
+			return nil, fmt.Errorf("socks5: %w: tls is not supported by sing-box socks", ErrUnsupportedTransport)
+		}
+		out := map[string]any{
+			"type":        "socks",
+			"server":      server,
+			"server_port": port,
+			"version":     "5",
+		}
+		copyCredentials(out, p)
+		return out, nil
+	case "http":
+		out := map[string]any{
+			"type":        "http",
+			"server":      server,
+			"server_port": port,
+		}
+		copyCredentials(out, p)
+		if tls := clashTLS(p, yamlBool(p, "tls"), server); tls != nil {
+			out["tls"] = tls
+		}
+		return out, nil
+	case "anytls":
+		out := map[string]any{
+			"type":        "anytls",
+			"server":      server,
+			"server_port": port,
+			"password":    yamlString(p, "password"),
+			"tls":         clashTLS(p, true, server),
+		}
+		if out["password"] == "" {
+			return nil, fmt.Errorf("anytls: missing password")
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("clash: %w: %s", ErrUnsupportedScheme, typ)
+	}
+}
+
+func clashShadowsocks(p map[string]any, server string, port int) (map[string]any, error) {
+	out := map[string]any{
+		"type":        "shadowsocks",
+		"server":      server,
+		"server_port": port,
+		"method":      yamlString(p, "cipher"),
+		"password":    yamlString(p, "password"),
+	}
+	if out["method"] == "" || out["password"] == "" {
+		return nil, fmt.Errorf("shadowsocks: missing cipher/password")
+	}
+	plugin := yamlString(p, "plugin")
+	if plugin == "" {
+		return out, nil
+	}
+	opts := yamlMap(p, "plugin-opts")
+	if plugin == "shadow-tls" {
+		detour, err := clashShadowTLS(p, opts, server, port)
+		if err != nil {
+			return nil, err
+		}
+		out["detour"] = detour
+		return out, nil
+	}
+	var parts []string
+	switch plugin {
+	case "obfs":
+		plugin = "obfs-local"
+		if mode := yamlString(opts, "mode"); mode != "" {
+			parts = append(parts, "obfs="+mode)
+		}
+		if host := yamlString(opts, "host"); host != "" {
+			parts = append(parts, "obfs-host="+host)
+		}
+	case "v2ray-plugin":
+		if mode := yamlString(opts, "mode"); mode != "" {
+			parts = append(parts, "mode="+mode)
+		}
+		if yamlBool(opts, "tls") {
+			parts = append(parts, "tls")
+		}
+		if host := yamlString(opts, "host"); host != "" {
+			parts = append(parts, "host="+host)
+		}
+		if path := yamlString(opts, "path"); path != "" {
+			parts = append(parts, "path="+path)
+		}
+		if yamlBool(opts, "mux") {
+			parts = append(parts, "mux=1")
+		}
+	default:
+		return nil, fmt.Errorf("shadowsocks: %w: plugin %s", ErrUnsupportedTransport, plugin)
+	}
+	out["plugin"] = plugin
+	if len(parts) > 0 {
+		out["plugin_opts"] = strings.Join(parts, ";")
+	}
+	return out, nil
+}
+
+// clashShadowTLS собирает shadowtls outbound, через который идёт shadowsocks (в узле он лежит в поле detour).
+// Версия по умолчанию — 2, как в Clash.
+func clashShadowTLS(p, opts map[string]any, server string, port int) (map[string]any, error) {
+	version := yamlInt(opts, "version")
+	if version == 0 {
+		version = 2
+	}
+	if version < 1 || version > 3 {
+		return nil, fmt.Errorf("shadowtls: unsupported version: %d", version)
+	}
+	host := yamlString(opts, "host")
+	if host == "" {
+		return nil, fmt.Errorf("shadowtls: missing host")
+	}
+	tls := map[string]any{"enabled": true, "server_name": host}
+	if fp := yamlString(p, "client-fingerprint"); fp != "" {
+		tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+	}
+	out := map[string]any{
+		"type":        "shadowtls",
+		"server":      server,
+		"server_port": port,
+		"version":     version,
+		"tls":         tls,
+	}
+	if version > 1 {
+		password := yamlString(opts, "password")
+		if password == "" {
+			return nil, fmt.Errorf("shadowtls: missing password")
+		}
+		out["password"] = password
+	}
+	return out, nil
+}
+
+// copyCredentials переносит username/password socks и http прокси (ключи в Clash и sing-box совпадают).
+func copyCredentials(dst, src map[string]any) {
+	if user := yamlString(src, "username"); user != "" {
+		dst["username"] = user
+	}
+	if pw := yamlString(src, "password"); pw != "" {
+		dst["password"] = pw
+	}
+}
+
+func clashWireGuard(p map[string]any, server string, port int) (map[string]any, error) {
+	privateKey := yamlString(p, "private-key")
+	publicKey := yamlString(p, "public-key")
+	if privateKey == "" || publicKey == "" {
+		return nil, fmt.Errorf("wireguard: missing private-key/public-key")
+	}
+	var addresses []string
+	if ip := yamlString(p, "ip"); ip != "" {
+		if !strings.Contains(ip, "/") {
+			ip += "/32"
+		}
+		addresses = append(addresses, ip)
+	}
+	if ip6 := yamlString(p, "ipv6"); ip6 != "" {
+		if !strings.Contains(ip6, "/") {
+			ip6 += "/128"
+		}
+		addresses = append(addresses, ip6)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("wireguard: missing ip")
+	}
+	if port == 0 {
+		port = 51820
+	}
+	allowed := yamlStrings(p, "allowed-ips")
+	if len(allowed) == 0 {
+		allowed = []string{"0.0.0.0/0", "::/0"}
+	}
+	peer := map[string]any{
+		"address":     server,
+		"port":        port,
+		"public_key":  publicKey,
+		"allowed_ips": allowed,
+	}
+	if psk := yamlString(p, "pre-shared-key"); psk != "" {
+		peer["pre_shared_key"] = psk
+	}
+	if reserved := yamlInts(p, "reserved"); len(reserved) == 3 {
+		peer["reserved"] = reserved
+	}
+	out := map[string]any{
+		"type":        "wireguard",
+		"address":     addresses,
+		"private_key": privateKey,
+		"peers":       []any{peer},
+	}
+	if mtu := yamlInt(p, "mtu"); mtu > 0 {
+		out["mtu"] = mtu
+	}
+	return out, nil
+}
+
+// clashTLS собирает sing-box tls из общих полей Clash. enabled=false и нет reality — nil.
+func clashTLS(p map[string]any, enabled bool, server string) map[string]any {
+	reality := yamlMap(p, "reality-opts")
+	if !enabled && reality == nil {
+		return nil
+	}
+	tls := map[string]any{"enabled": true}
+	sni := yamlString(p, "servername")
+	if sni == "" {
+		sni = yamlString(p, "sni")
+	}
+	if sni == "" {
+		sni = server
+	}
+	tls["server_name"] = sni
+	if yamlBool(p, "skip-cert-verify") {
+		tls["insecure"] = true
+	}
+	if alpn := yamlStrings(p, "alpn"); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if ech := yamlMap(p, "ech-opts"); yamlBool(ech, "enable") {
+		opts := map[string]any{"enabled": true}
+		if config := yamlString(ech, "config"); config != "" {
+			opts["config"] = []string{"-----BEGIN ECH CONFIGS-----", config, "-----END ECH CONFIGS-----"}
+		}
+		tls["ech"] = opts
+	}
+	fp := yamlString(p, "client-fingerprint")
+	if reality != nil {
+		tls["reality"] = map[string]any{
+			"enabled":    true,
+			"public_key": yamlString(reality, "public-key"),
+			"short_id":   yamlString(reality, "short-id"),
+		}
+		// Reality client требует uTLS.
+		if fp == "" {
+			fp = "chrome"
+		}
+	}
+	if fp != "" {
+		tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+	}
+	return tls
+}
+
+// clashWithTransport добавляет в outbound транспорт по полю network (ws/grpc/h2/http).
+func clashWithTransport(p map[string]any, out map[string]any) (map[string]any, error) {
+	switch network := strings.ToLower(yamlString(p, "network")); network {
+	case "", "tcp":
+	case "ws":
+		opts := yamlMap(p, "ws-opts")
+		ws := map[string]any{"type": "ws"}
+		if yamlBool(opts, "v2ray-http-upgrade") {
+			ws["type"] = "httpupgrade"
+		}
+		if path := yamlString(opts, "path"); path != "" {
+			ws["path"] = path
+		}
+		if headers := yamlMap(opts, "headers"); len(headers) > 0 {
+			if ws["type"] == "httpupgrade" {
+				if host := yamlString(headers, "Host"); host != "" {
+					ws["host"] = host
+				}
+			} else {
+				ws["headers"] = headers
+			}
+		}
+		if ws["type"] == "ws" {
+			if ed := yamlInt(opts, "max-early-data"); ed > 0 {
+				ws["max_early_data"] = ed
+			}
+			if name := yamlString(opts, "early-data-header-name"); name != "" {
+				ws["early_data_header_name"] = name
+			}
+		}
+		out["transport"] = ws
+	case "grpc":
+		grpc := map[string]any{"type": "grpc"}
+		if name := yamlString(yamlMap(p, "grpc-opts"), "grpc-service-name"); name != "" {
+			grpc["service_name"] = name
+		}
+		out["transport"] = grpc
+	case "h2", "http":
+		key := "h2-opts"
+		if network == "http" {
+			key = "http-opts"
+		}
+		opts := yamlMap(p, key)
+		h := map[string]any{"type": "http"}
+		hosts := yamlStrings(opts, "host")
+		if len(hosts) == 0 {
+			// В http-opts хосты задаются заголовком Host.
+			hosts = yamlStrings(yamlMap(opts, "headers"), "Host")
+		}
+		if len(hosts) > 0 {
+			h["host"] = hosts
+		}
+		if paths := yamlStrings(opts, "path"); len(paths) > 0 {
+			h["path"] = paths[0]
+		}
+		if method := yamlString(opts, "method"); method != "" {
+			h["method"] = method
+		}
+		out["transport"] = h
+	default:
+		return nil, fmt.Errorf("clash: %w: %s", ErrUnsupportedTransport, network)
+	}
+	return out, nil
+}
+
+// parseClashMbps понимает "100", "100 Mbps" (в Clash up/down бывают и числом, и строкой).
+func parseClashMbps(s string) int {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimSpace(strings.TrimSuffix(s, "mbps"))
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func yamlString(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case int, int64, float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func yamlInt(m map[string]any, key string) int {
+	switch v := m[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	}
+	return 0
+}
+
+func yamlBool(m map[string]any, key string) bool {
+	switch v := m[key].(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+func yamlMap(m map[string]any, key string) map[string]any {
+	if v, ok := m[key].(map[string]any); ok {
+		return v
+	}
+	return nil
+}
+
+// yamlStrings принимает и список, и строку через запятую (и []string из outbound, собранного в Go; всегда копия).
+func yamlStrings(m map[string]any, key string) []string {
+	switch v := m[key].(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func yamlInts(m map[string]any, key string) []int {
+	if v, ok := m[key].([]int); ok {
+		return append([]int(nil), v...)
+	}
+	var out []int
+	for _, s := range yamlStrings(m, key) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil
+		}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package subscription
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClashProxyPort(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy map[string]any
+		port  any // ожидаемый server_port; nil — прокси отклоняется
+	}{
+		{"vless", map[string]any{"type": "vless", "server": "a.example.com", "port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811"}, 443},
+		{"vless without port", map[string]any{"type": "vless", "server": "a.example.com",
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811"}, nil},
+		{"vmess without port", map[string]any{"type": "vmess", "server": "a.example.com",
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811"}, nil},
+		{"trojan with bad port", map[string]any{"type": "trojan", "server": "a.example.com", "port": "https",
+			"password": "secret"}, nil},
+		{"ss with port out of range", map[string]any{"type": "ss", "server": "a.example.com", "port": 70000,
+			"cipher": "aes-256-gcm", "password": "secret"}, nil},
+		{"ss with string port", map[string]any{"type": "ss", "server": "a.example.com", "port": "8388",
+			"cipher": "aes-256-gcm", "password": "secret"}, 8388},
+		{"hysteria2 defaults to 443", map[string]any{"type": "hysteria2", "server": "a.example.com",
+			"password": "secret"}, 443},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := clashProxyToOutbound(tt.proxy)
+			if tt.port == nil {
+				if err == nil {
+					t.Fatalf("expected error, got %v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out["server_port"] != tt.port {
+				t.Errorf("server_port = %v, want %v", out["server_port"], tt.port)
+			}
+		})
+	}
+}
+
+func TestClashHysteria2Ports(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy map[string]any
+		want  map[string]any
+	}{
+		{
+			name: "main port outside ranges",
+			proxy: map[string]any{"type": "hysteria2", "name": "hy", "server": "hy.example.com", "port": 443,
+				"password": "secret", "ports": "20000-30000, 40000", "up": "50 Mbps", "down": "100",
+				"obfs": "salamander", "obfs-password": "cry", "sni": "cdn.example.com"},
+			want: map[string]any{
+				"type": "hysteria2", "server": "hy.example.com", "server_port": 443, "password": "secret",
+				"server_ports": []string{"443:443", "20000:30000", "40000:40000"},
+				"up_mbps":      50, "down_mbps": 100,
+				"obfs": map[string]any{"type": "salamander", "password": "cry"},
+				"tls":  map[string]any{"enabled": true, "server_name": "cdn.example.com"},
+			},
+		},
+		{
+			name: "main port inside a range",
+			proxy: map[string]any{"type": "hysteria2", "server": "hy.example.com", "port": 25000,
+				"password": "secret", "ports": "20000-30000"},
+			want: map[string]any{
+				"type": "hysteria2", "server": "hy.example.com", "server_port": 25000, "password": "secret",
+				"server_ports": []string{"20000:30000"},
+				"tls":          map[string]any{"enabled": true, "server_name": "hy.example.com"},
+			},
+		},
+		{
+			name: "only ranges",
+			proxy: map[string]any{"type": "hy2", "server": "hy.example.com", "password": "secret",
+				"ports": "20000-30000"},
+			want: map[string]any{
+				"type": "hysteria2", "server": "hy.example.com", "server_port": 20000, "password": "secret",
+				"server_ports": []string{"20000:30000"},
+				"tls":          map[string]any{"enabled": true, "server_name": "hy.example.com"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := clashProxyToOutbound(tt.proxy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outbound\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package subscription
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// countryNames — распространённые названия стран в именах узлов (английские и русские, в нижнем регистре) → ISO 3166-1 alpha-2.
+var countryNames = map[string]string{
+	"austria": "AT", "австрия": "AT",
+	"argentina": "AR", "аргентина": "AR",
+	"armenia": "AM", "армения": "AM",
+	"australia": "AU", "австралия": "AU",
+	"belgium": "BE", "бельгия": "BE",
+	"brazil": "BR", "бразилия": "BR",
+	"bulgaria": "BG", "болгария": "BG",
+	"canada": "CA", "канада": "CA",
+	"chile": "CL", "чили": "CL",
+	"czech": "CZ", "czechia": "CZ", "чехия": "CZ",
+	"denmark": "DK", "дания": "DK",
+	"estonia": "EE", "эстония": "EE",
+	"finland": "FI", "финляндия": "FI",
+	"france": "FR", "франция": "FR",
+	"georgia": "GE", "грузия": "GE",
+	"germany": "DE", "германия": "DE",
+	"greece": "GR", "греция": "GR",
+	"hong kong": "HK", "hongkong": "HK", "гонконг": "HK",
+	"hungary": "HU", "венгрия": "HU",
+	"india": "IN", "индия": "IN",
+	"indonesia": "ID", "индонезия": "ID",
+	"ireland": "IE", "ирландия": "IE",
+	"israel": "IL", "израиль": "IL",
+	"italy": "IT", "италия": "IT",
+	"japan": "JP", "япония": "JP",
+	"kazakhstan": "KZ", "казахстан": "KZ",
+	"korea": "KR", "south korea": "KR", "корея": "KR",
+	"latvia": "LV", "латвия": "LV",
+	"lithuania": "LT", "литва": "LT",
+	"luxembourg": "LU", "люксембург": "LU",
+	"malaysia": "MY", "малайзия": "MY",
+	"mexico": "MX", "мексика": "MX",
+	"moldova": "MD", "молдова": "MD",
+	"netherlands": "NL", "holland": "NL", "нидерланды": "NL", "голландия": "NL",
+	"norway": "NO", "норвегия": "NO",
+	"poland": "PL", "польша": "PL",
+	"portugal": "PT", "португалия": "PT",
+	"romania": "RO", "румыния": "RO",
+	"russia": "RU", "россия": "RU",
+	"serbia": "RS", "сербия": "RS",
+	"singapore": "SG", "сингапур": "SG",
+	"slovakia": "SK", "словакия": "SK",
+	"spain": "ES", "испания": "ES",
+	"sweden": "SE", "швеция": "SE",
+	"switzerland": "CH", "швейцария": "CH",
+	"taiwan": "TW", "тайвань": "TW",
+	"thailand": "TH", "таиланд": "TH",
+	"turkey": "TR", "türkiye": "TR", "турция": "TR",
+	"ukraine": "UA", "украина": "UA",
+	"united arab emirates": "AE", "uae": "AE", "оаэ": "AE",
+	"united kingdom": "GB", "great britain": "GB", "england": "GB", "london": "GB", "великобритания": "GB", "англия": "GB",
+	"united states": "US", "usa": "US", "america": "US", "сша": "US", "америка": "US",
+	"vietnam": "VN", "вьетнам": "VN",
+	"uzbekistan": "UZ", "узбекистан": "UZ",
+	"frankfurt": "DE", "франкфурт": "DE",
+	"amsterdam": "NL", "амстердам": "NL",
+	"helsinki": "FI", "хельсинки": "FI",
+	"moscow": "RU", "москва": "RU",
+	"tokyo": "JP", "токио": "JP",
+	"istanbul": "TR", "стамбул": "TR",
+}
+
+// countryAliases — коды, которые встречаются в именах, но не являются ISO alpha-2.
+var countryAliases = map[string]string{
+	"UK": "GB", "USA": "US", "UAE": "AE",
+}
+
+// isoCountries — допустимые ISO alpha-2 коды (те, что встречаются в countryNames).
+var isoCountries = func() map[string]bool {
+	m := make(map[string]bool, len(countryNames))
+	for _, code := range countryNames {
+		m[code] = true
+	}
+	return m
+}()
+
+// CountryFromName определяет страну узла по имени: флаг-эмодзи, затем название страны или города,
+// затем отдельно стоящий ISO-код ("DE", "[NL]", "US-2"). Пусто — не удалось.
+func CountryFromName(name string) string {
+	if code := countryFromFlag(name); code != "" {
+		return code
+	}
+	lower := strings.ToLower(name)
+	words := splitWords(lower)
+	best, bestKey := "", ""
+	for key, code := range countryNames {
+		// Длинные совпадения важнее ("south korea" против "korea"); при равной длине — по алфавиту,
+		// чтобы результат не зависел от порядка обхода map. Многословные названия ищем подстрокой.
+		if len(key) < len(bestKey) || (len(key) == len(bestKey) && key > bestKey) {
+			continue
+		}
+		if strings.Contains(key, " ") {
+			if strings.Contains(lower, key) {
+				best, bestKey = code, key
+			}
+			continue
+		}
+		for _, w := range words {
+			if w == key {
+				best, bestKey = code, key
+				break
+			}
+		}
+	}
+	if best != "" {
+		return best
+	}
+	// Коды — только заглавными, иначе "in", "no", "it" из обычных слов дают ложные срабатывания.
+	for _, w := range splitWords(name) {
+		if code, ok := countryAliases[w]; ok {
+			return code
+		}
+		if len(w) == 2 && isoCountries[w] {
+			return w
+		}
+	}
+	return ""
+}
+
+// countryFromFlag — первый флаг-эмодзи (пара regional indicator) в строке.
+func countryFromFlag(s string) string {
+	runes := []rune(s)
+	for i := 0; i+1 < len(runes); i++ {
+		a, b := runes[i], runes[i+1]
+		if isRegionalIndicator(a) && isRegionalIndicator(b) {
+			return string([]rune{'A' + (a - 0x1F1E6), 'A' + (b - 0x1F1E6)})
+		}
+	}
+	return ""
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// DetectCountries заполняет пустой Country узлов по их именам.
+func DetectCountries(nodes []store.ServerNode) []store.ServerNode {
+	for i := range nodes {
+		if nodes[i].Country == "" {
+			nodes[i].Country = CountryFromName(nodes[i].Name)
+		}
+	}
+	return nodes
+}
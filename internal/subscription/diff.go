@@ -0,0 +1,94 @@
+package subscription
+
+import (
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// DiffEntry — узел в отчёте об обновлении подписки.
+// Для changed OldID — прежний ID узла; для переименованных unchanged OldName — прежнее имя.
+type DiffEntry struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	OldID   string `json:"old_id,omitempty"`
+	OldName string `json:"old_name,omitempty"`
+}
+
+// Diff — что изменилось в списке серверов подписки после обновления.
+// Узлы сопоставляются по ID (отпечатку); оставшиеся — по имени: такой узел сменил адрес или учётные данные.
+type Diff struct {
+	Added     []DiffEntry `json:"added"`
+	Removed   []DiffEntry `json:"removed"`
+	Changed   []DiffEntry `json:"changed"`
+	Unchanged []DiffEntry `json:"unchanged"`
+}
+
+// DiffServers сравнивает прежний и новый списки серверов.
+func DiffServers(old, next []store.ServerNode) Diff {
+	d := Diff{
+		Added:     []DiffEntry{},
+		Removed:   []DiffEntry{},
+		Changed:   []DiffEntry{},
+		Unchanged: []DiffEntry{},
+	}
+	oldByID := make(map[string]store.ServerNode, len(old))
+	for _, n := range old {
+		oldByID[n.ID] = n
+	}
+	nextIDs := make(map[string]bool, len(next))
+	for _, n := range next {
+		nextIDs[n.ID] = true
+	}
+	// Прежние узлы, чей отпечаток исчез, — кандидаты в changed по имени.
+	goneByName := make(map[string]store.ServerNode)
+	for _, n := range old {
+		if !nextIDs[n.ID] {
+			goneByName[strings.ToLower(n.Name)] = n
+		}
+	}
+	for _, n := range next {
+		if prev, ok := oldByID[n.ID]; ok {
+			e := DiffEntry{ID: n.ID, Name: n.Name}
+			if prev.Name != n.Name {
+				e.OldName = prev.Name
+			}
+			d.Unchanged = append(d.Unchanged, e)
+			continue
+		}
+		key := strings.ToLower(n.Name)
+		if prev, ok := goneByName[key]; ok {
+			delete(goneByName, key)
+			delete(oldByID, prev.ID)
+			d.Changed = append(d.Changed, DiffEntry{ID: n.ID, Name: n.Name, OldID: prev.ID})
+			continue
+		}
+		d.Added = append(d.Added, DiffEntry{ID: n.ID, Name: n.Name})
+	}
+	for _, n := range old {
+		if _, ok := oldByID[n.ID]; ok && !nextIDs[n.ID] {
+			d.Removed = append(d.Removed, DiffEntry{ID: n.ID, Name: n.Name})
+		}
+	}
+	return d
+}
+
+// UnchangedDiff возвращает отчёт, в котором все узлы остались прежними (ответ 304).
+func UnchangedDiff(servers []store.ServerNode) Diff {
+	return DiffServers(servers, servers)
+}
+
+// Affects — затронуло ли обновление узел с данным ID (удалён или сменил адрес/учётные данные).
+func (d Diff) Affects(id string) bool {
+	for _, e := range d.Removed {
+		if e.ID == id {
+			return true
+		}
+	}
+	for _, e := range d.Changed {
+		if e.OldID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,858 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrDetourChain — узел подключается через другой сохранённый сервер (detour — ID сервера). Ни ссылка,
+// ни отдельный прокси Clash цепочку не передают, а без неё узел подключался бы напрямую — такой узел не экспортируется.
+var ErrDetourChain = errors.New("connects through another server")
+
+// checkDetourChain отвергает узел с detour-ссылкой на другой сервер (вложенный ShadowTLS — не цепочка).
+func checkDetourChain(ob map[string]any) error {
+	if id := yamlString(ob, "detour"); id != "" {
+		return fmt.Errorf("export: %w: %s", ErrDetourChain, id)
+	}
+	return nil
+}
+
+// OutboundToURI кодирует sing-box outbound (или wireguard endpoint) обратно в share-ссылку.
+// Ссылка каноническая: строится из разобранного outbound, а не копирует исходную строку подписки,
+// поэтому узлы из Clash/sing-box/SIP008 тоже экспортируются. name попадает во фрагмент (#name).
+func OutboundToURI(name string, ob map[string]any) (string, error) {
+	if err := checkDetourChain(ob); err != nil {
+		return "", err
+	}
+	server := yamlString(ob, "server")
+	port := yamlInt(ob, "server_port")
+	switch typ := yamlString(ob, "type"); typ {
+	case "vless":
+		q := url.Values{}
+		q.Set("encryption", "none")
+		if flow := yamlString(ob, "flow"); flow != "" {
+			q.Set("flow", flow)
+		}
+		tlsQuery(q, yamlMap(ob, "tls"))
+		if err := transportQuery(q, yamlMap(ob, "transport"), yamlBool(yamlMap(ob, "tls"), "enabled")); err != nil {
+			return "", err
+		}
+		u := url.URL{Scheme: "vless", User: url.User(yamlString(ob, "uuid")), Host: joinHostPort(server, port), RawQuery: q.Encode(), Fragment: name}
+		return u.String(), nil
+	case "trojan":
+		q := url.Values{}
+		tlsQuery(q, yamlMap(ob, "tls"))
+		if err := transportQuery(q, yamlMap(ob, "transport"), yamlBool(yamlMap(ob, "tls"), "enabled")); err != nil {
+			return "", err
+		}
+		u := url.URL{Scheme: "trojan", User: url.User(yamlString(ob, "password")), Host: joinHostPort(server, port), RawQuery: q.Encode(), Fragment: name}
+		return u.String(), nil
+	case "vmess":
+		return vmessURI(name, ob)
+	case "shadowsocks":
+		userinfo := base64.RawURLEncoding.EncodeToString([]byte(yamlString(ob, "method") + ":" + yamlString(ob, "password")))
+		uri := "ss://" + userinfo + "@" + joinHostPort(server, port)
+		spec := yamlString(ob, "plugin")
+		if opts := yamlString(ob, "plugin_opts"); spec != "" && opts != "" {
+			spec += ";" + opts
+		}
+		if detour := yamlMap(ob, "detour"); detour != nil {
+			if yamlString(detour, "type") != "shadowtls" || spec != "" {
+				return "", fmt.Errorf("export: shadowsocks: %w: detour %s", ErrUnsupportedTransport, yamlString(detour, "type"))
+			}
+			spec = "shadow-tls;" + shadowTLSPluginOpts(detour)
+		}
+		if spec != "" {
+			uri += "/?plugin=" + url.QueryEscape(spec)
+		}
+		return uri + "#" + url.PathEscape(name), nil
+	case "socks":
+		scheme := "socks5"
+		switch yamlString(ob, "version") {
+		case "4":
+			scheme = "socks4"
+		case "4a":
+			scheme = "socks4a"
+		}
+		u := url.URL{Scheme: scheme, User: proxyUserinfo(ob), Host: joinHostPort(server, port), Fragment: name}
+		return u.String(), nil
+	case "http":
+		u := url.URL{Scheme: "http", User: proxyUserinfo(ob), Host: joinHostPort(server, port), Fragment: name}
+		if tls := yamlMap(ob, "tls"); yamlBool(tls, "enabled") {
+			u.Scheme = "https"
+			q := url.Values{}
+			tlsQuery(q, tls)
+			q.Del("security")
+			if q.Get("sni") == server {
+				q.Del("sni")
+			}
+			u.RawQuery = q.Encode()
+		}
+		return u.String(), nil
+	case "naive":
+		u := url.URL{Scheme: "naive+https", User: proxyUserinfo(ob), Host: joinHostPort(server, port), Fragment: name}
+		if yamlBool(ob, "quic") {
+			u.Scheme = "naive+quic"
+		}
+		if headers := yamlMap(ob, "extra_headers"); len(headers) > 0 {
+			lines := make([]string, 0, len(headers))
+			for k := range headers {
+				lines = append(lines, k+": "+yamlString(headers, k))
+			}
+			sort.Strings(lines)
+			u.RawQuery = url.Values{"extra-headers": {strings.Join(lines, "\r\n")}}.Encode()
+		}
+		return u.String(), nil
+	case "anytls":
+		q := url.Values{}
+		tlsQuery(q, yamlMap(ob, "tls"))
+		u := url.URL{Scheme: "anytls", User: url.User(yamlString(ob, "password")), Host: joinHostPort(server, port), RawQuery: q.Encode(), Fragment: name}
+		return u.String(), nil
+	case "hysteria2":
+		return hysteria2URI(name, ob)
+	case "tuic":
+		return tuicURI(name, ob)
+	case "wireguard":
+		return wireguardURI(name, ob)
+	default:
+		return "", fmt.Errorf("export: %w: %s", ErrUnsupportedScheme, typ)
+	}
+}
+
+// EncodeURIList — тело подписки в виде списка ссылок, по одной на строку.
+func EncodeURIList(uris []string) string {
+	if len(uris) == 0 {
+		return ""
+	}
+	return strings.Join(uris, "\n") + "\n"
+}
+
+// EncodeBase64 — классическая base64-подписка (список ссылок в стандартном base64).
+func EncodeBase64(uris []string) string {
+	return base64.StdEncoding.EncodeToString([]byte(EncodeURIList(uris)))
+}
+
+func vmessURI(name string, ob map[string]any) (string, error) {
+	v := struct {
+		V    string `json:"v"`
+		PS   string `json:"ps"`
+		Add  string `json:"add"`
+		Port string `json:"port"`
+		ID   string `json:"id"`
+		Aid  string `json:"aid"`
+		Scy  string `json:"scy"`
+		Net  string `json:"net"`
+		Type string `json:"type"`
+		Host string `json:"host"`
+		Path string `json:"path"`
+		TLS  string `json:"tls"`
+		SNI  string `json:"sni,omitempty"`
+		ALPN string `json:"alpn,omitempty"`
+		FP   string `json:"fp,omitempty"`
+		// Поля вне схемы v2rayN: без них узел после импорта работал бы иначе.
+		AllowInsecure       string `json:"allowInsecure,omitempty"`
+		PacketEncoding      string `json:"packet_encoding,omitempty"`
+		GlobalPadding       bool   `json:"global_padding,omitempty"`
+		AuthenticatedLength bool   `json:"authenticated_length,omitempty"`
+	}{
+		V:    "2",
+		PS:   name,
+		Add:  yamlString(ob, "server"),
+		Port: strconv.Itoa(yamlInt(ob, "server_port")),
+		ID:   yamlString(ob, "uuid"),
+		Aid:  strconv.Itoa(yamlInt(ob, "alter_id")),
+		Scy:  yamlString(ob, "security"),
+		Net:  "tcp",
+		Type: "none",
+
+		PacketEncoding:      yamlString(ob, "packet_encoding"),
+		GlobalPadding:       yamlBool(ob, "global_padding"),
+		AuthenticatedLength: yamlBool(ob, "authenticated_length"),
+	}
+	if v.Scy == "" {
+		v.Scy = "auto"
+	}
+	tls := yamlMap(ob, "tls")
+	if yamlBool(tls, "enabled") {
+		v.TLS = "tls"
+		v.SNI = yamlString(tls, "server_name")
+		v.ALPN = strings.Join(yamlStrings(tls, "alpn"), ",")
+		v.FP = yamlString(yamlMap(tls, "utls"), "fingerprint")
+		if yamlBool(tls, "insecure") {
+			v.AllowInsecure = "1"
+		}
+	}
+	if t := yamlMap(ob, "transport"); t != nil {
+		switch typ := yamlString(t, "type"); typ {
+		case "ws", "httpupgrade":
+			v.Net = typ
+			v.Path = yamlString(t, "path")
+			v.Host = transportHost(t)
+			if ed := yamlInt(t, "max_early_data"); typ == "ws" && ed > 0 {
+				v.Path += "?ed=" + strconv.Itoa(ed)
+			}
+		case "grpc":
+			v.Net = "grpc"
+			v.Path = yamlString(t, "service_name")
+		case "http":
+			// С TLS это h2, без TLS — tcp с маскировкой под HTTP.
+			v.Net = "h2"
+			if !yamlBool(tls, "enabled") {
+				v.Net, v.Type = "tcp", "http"
+			}
+			v.Path = yamlString(t, "path")
+			v.Host = strings.Join(yamlStrings(t, "host"), ",")
+		case "quic":
+			v.Net = "quic"
+		default:
+			return "", fmt.Errorf("export: vmess: %w: %s", ErrUnsupportedTransport, typ)
+		}
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+func hysteria2URI(name string, ob map[string]any) (string, error) {
+	q := url.Values{}
+	tls := yamlMap(ob, "tls")
+	if sni := yamlString(tls, "server_name"); sni != "" {
+		q.Set("sni", sni)
+	}
+	if yamlBool(tls, "insecure") {
+		q.Set("insecure", "1")
+	}
+	if alpn := yamlStrings(tls, "alpn"); len(alpn) > 0 {
+		q.Set("alpn", strings.Join(alpn, ","))
+	}
+	if obfs := yamlMap(ob, "obfs"); obfs != nil {
+		q.Set("obfs", yamlString(obfs, "type"))
+		q.Set("obfs-password", yamlString(obfs, "password"))
+	}
+	if ranges := hysteria2HopPorts(ob); len(ranges) > 0 {
+		q.Set("mport", strings.Join(ranges, ","))
+		if hop := yamlString(ob, "hop_interval"); hop != "" {
+			q.Set("hop_interval", hop)
+		}
+	}
+	if up := yamlInt(ob, "up_mbps"); up > 0 {
+		q.Set("up", strconv.Itoa(up))
+	}
+	if down := yamlInt(ob, "down_mbps"); down > 0 {
+		q.Set("down", strconv.Itoa(down))
+	}
+	u := url.URL{Scheme: "hysteria2", Host: joinHostPort(yamlString(ob, "server"), yamlInt(ob, "server_port")), Path: "/", RawQuery: q.Encode(), Fragment: name}
+	if pw := yamlString(ob, "password"); pw != "" {
+		u.User = url.User(pw)
+	}
+	return u.String(), nil
+}
+
+// hysteria2HopPorts — server_ports в виде "20000-30000" для mport/ports. Основной порт, который парсер
+// добавляет в server_ports ("443:443"), и так стоит в адресе, поэтому пропускается.
+func hysteria2HopPorts(ob map[string]any) []string {
+	main := strconv.Itoa(yamlInt(ob, "server_port"))
+	var out []string
+	for _, r := range yamlStrings(ob, "server_ports") {
+		if r == main+":"+main {
+			continue
+		}
+		out = append(out, strings.Replace(r, ":", "-", 1))
+	}
+	return out
+}
+
+func tuicURI(name string, ob map[string]any) (string, error) {
+	q := url.Values{}
+	if cc := yamlString(ob, "congestion_control"); cc != "" {
+		q.Set("congestion_control", cc)
+	}
+	if mode := yamlString(ob, "udp_relay_mode"); mode != "" {
+		q.Set("udp_relay_mode", mode)
+	}
+	if yamlBool(ob, "zero_rtt_handshake") {
+		q.Set("reduce_rtt", "1")
+	}
+	if hb := yamlString(ob, "heartbeat"); hb != "" {
+		q.Set("heartbeat", hb)
+	}
+	tls := yamlMap(ob, "tls")
+	if sni := yamlString(tls, "server_name"); sni != "" {
+		q.Set("sni", sni)
+	}
+	if alpn := yamlStrings(tls, "alpn"); len(alpn) > 0 {
+		q.Set("alpn", strings.Join(alpn, ","))
+	}
+	if yamlBool(tls, "insecure") {
+		q.Set("allow_insecure", "1")
+	}
+	if yamlBool(tls, "disable_sni") {
+		q.Set("disable_sni", "1")
+	}
+	user := url.User(yamlString(ob, "uuid"))
+	if pw := yamlString(ob, "password"); pw != "" {
+		user = url.UserPassword(yamlString(ob, "uuid"), pw)
+	}
+	u := url.URL{Scheme: "tuic", User: user, Host: joinHostPort(yamlString(ob, "server"), yamlInt(ob, "server_port")), RawQuery: q.Encode(), Fragment: name}
+	return u.String(), nil
+}
+
+// wireguardURI понимает и endpoint (sing-box 1.11+, peers), и старый outbound (server/peer_public_key).
+func wireguardURI(name string, ob map[string]any) (string, error) {
+	host, port := yamlString(ob, "server"), yamlInt(ob, "server_port")
+	publicKey, psk := yamlString(ob, "peer_public_key"), yamlString(ob, "pre_shared_key")
+	addresses := yamlStrings(ob, "address")
+	if len(addresses) == 0 {
+		addresses = yamlStrings(ob, "local_address")
+	}
+	var allowed []string
+	var reserved []int
+	keepalive := 0
+	if peers := yamlMaps(ob, "peers"); len(peers) > 0 {
+		peer := peers[0]
+		host, port = yamlString(peer, "address"), yamlInt(peer, "port")
+		publicKey, psk = yamlString(peer, "public_key"), yamlString(peer, "pre_shared_key")
+		allowed = yamlStrings(peer, "allowed_ips")
+		reserved = yamlInts(peer, "reserved")
+		keepalive = yamlInt(peer, "persistent_keepalive_interval")
+	}
+	if host == "" || publicKey == "" {
+		return "", fmt.Errorf("export: wireguard: missing peer")
+	}
+	q := url.Values{}
+	q.Set("publickey", publicKey)
+	q.Set("address", strings.Join(addresses, ","))
+	if psk != "" {
+		q.Set("presharedkey", psk)
+	}
+	if len(allowed) > 0 {
+		q.Set("allowedips", strings.Join(allowed, ","))
+	}
+	if len(reserved) == 3 {
+		q.Set("reserved", fmt.Sprintf("%d,%d,%d", reserved[0], reserved[1], reserved[2]))
+	}
+	if keepalive > 0 {
+		q.Set("keepalive", strconv.Itoa(keepalive))
+	}
+	if mtu := yamlInt(ob, "mtu"); mtu > 0 {
+		q.Set("mtu", strconv.Itoa(mtu))
+	}
+	return "wireguard://" + url.PathEscape(yamlString(ob, "private_key")) + "@" + joinHostPort(host, port) +
+		"?" + q.Encode() + "#" + url.PathEscape(name), nil
+}
+
+// tlsQuery переносит sing-box tls в параметры vless/trojan ссылки (security, sni, alpn, fp, pbk, sid, ech, pcs).
+// Без TLS пишется security=none: у trojan иначе TLS включился бы по умолчанию.
+func tlsQuery(q url.Values, tls map[string]any) {
+	if !yamlBool(tls, "enabled") {
+		q.Set("security", "none")
+		return
+	}
+	security := "tls"
+	if reality := yamlMap(tls, "reality"); yamlBool(reality, "enabled") {
+		security = "reality"
+		q.Set("pbk", yamlString(reality, "public_key"))
+		if sid := yamlString(reality, "short_id"); sid != "" {
+			q.Set("sid", sid)
+		}
+	}
+	q.Set("security", security)
+	if sni := yamlString(tls, "server_name"); sni != "" {
+		q.Set("sni", sni)
+	}
+	if alpn := yamlStrings(tls, "alpn"); len(alpn) > 0 {
+		q.Set("alpn", strings.Join(alpn, ","))
+	}
+	if fp := yamlString(yamlMap(tls, "utls"), "fingerprint"); fp != "" {
+		q.Set("fp", fp)
+	}
+	if yamlBool(tls, "insecure") {
+		q.Set("allowInsecure", "1")
+	}
+	// ECH без config (sing-box берёт его из DNS) в ссылке не выразить — такой узел экспортируется без ech.
+	if config := echConfigBase64(yamlMap(tls, "ech")); config != "" {
+		q.Set("ech", config)
+	}
+	if pins := yamlStrings(tls, "certificate_public_key_sha256"); len(pins) > 0 {
+		q.Set("pcs", strings.Join(pins, ","))
+	}
+}
+
+// echConfigBase64 достаёт ECHConfigList в base64 из PEM-строк sing-box ech.config.
+func echConfigBase64(ech map[string]any) string {
+	if !yamlBool(ech, "enabled") {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range yamlStrings(ech, "config") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "-----") {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// transportQuery переносит sing-box transport в type/path/host/serviceName ссылки.
+// http без TLS — это tcp с маскировкой под HTTP (headerType=http), с TLS — h2.
+func transportQuery(q url.Values, t map[string]any, tlsEnabled bool) error {
+	if t == nil {
+		q.Set("type", "tcp")
+		return nil
+	}
+	switch typ := yamlString(t, "type"); typ {
+	case "ws", "httpupgrade":
+		q.Set("type", typ)
+		path := yamlString(t, "path")
+		if ed := yamlInt(t, "max_early_data"); typ == "ws" && ed > 0 {
+			// Как у Xray: размер ранних данных — в пути, имя заголовка — только если оно нестандартное.
+			path += "?ed=" + strconv.Itoa(ed)
+			if name := yamlString(t, "early_data_header_name"); name != "" && name != "Sec-WebSocket-Protocol" {
+				q.Set("eh", name)
+			}
+		}
+		if path != "" {
+			q.Set("path", path)
+		}
+		if host := transportHost(t); host != "" {
+			q.Set("host", host)
+		}
+	case "grpc":
+		q.Set("type", "grpc")
+		if name := yamlString(t, "service_name"); name != "" {
+			q.Set("serviceName", name)
+		}
+	case "http":
+		q.Set("type", "http")
+		if !tlsEnabled {
+			q.Set("type", "tcp")
+			q.Set("headerType", "http")
+		}
+		if path := yamlString(t, "path"); path != "" {
+			q.Set("path", path)
+		}
+		if hosts := yamlStrings(t, "host"); len(hosts) > 0 {
+			q.Set("host", strings.Join(hosts, ","))
+		}
+	case "quic":
+		q.Set("type", "quic")
+	default:
+		return fmt.Errorf("export: %w: %s", ErrUnsupportedTransport, typ)
+	}
+	return nil
+}
+
+// transportHost — Host для ws (заголовок) или httpupgrade (поле host).
+func transportHost(t map[string]any) string {
+	if host := yamlString(t, "host"); host != "" {
+		return host
+	}
+	if hosts := yamlStrings(yamlMap(t, "headers"), "Host"); len(hosts) > 0 {
+		return hosts[0]
+	}
+	return ""
+}
+
+// OutboundToClash — обратное к clashProxyToOutbound: элемент proxies: для Clash/Mihomo.
+// В Clash нет naive и socks4/4a (ErrUnsupportedScheme) и транспорта quic (ErrUnsupportedTransport) —
+// такие узлы экспортируются только ссылкой или в sing-box.
+func OutboundToClash(name string, ob map[string]any) (map[string]any, error) {
+	if err := checkDetourChain(ob); err != nil {
+		return nil, err
+	}
+	typ := yamlString(ob, "type")
+	if typ == "wireguard" {
+		return clashFromWireGuard(name, ob)
+	}
+	p := map[string]any{
+		"name":   name,
+		"server": yamlString(ob, "server"),
+		"port":   yamlInt(ob, "server_port"),
+		"udp":    true,
+	}
+	tls := yamlMap(ob, "tls")
+	switch typ {
+	case "vmess":
+		p["type"] = "vmess"
+		p["uuid"] = yamlString(ob, "uuid")
+		p["alterId"] = yamlInt(ob, "alter_id")
+		p["cipher"] = "auto"
+		if security := yamlString(ob, "security"); security != "" {
+			p["cipher"] = security
+		}
+		clashFromTLS(p, tls, "servername")
+		return p, clashFromTransport(p, yamlMap(ob, "transport"))
+	case "vless":
+		p["type"] = "vless"
+		p["uuid"] = yamlString(ob, "uuid")
+		if flow := yamlString(ob, "flow"); flow != "" {
+			p["flow"] = flow
+		}
+		clashFromTLS(p, tls, "servername")
+		return p, clashFromTransport(p, yamlMap(ob, "transport"))
+	case "trojan":
+		p["type"] = "trojan"
+		p["password"] = yamlString(ob, "password")
+		clashFromTLS(p, tls, "sni")
+		delete(p, "tls")
+		return p, clashFromTransport(p, yamlMap(ob, "transport"))
+	case "shadowsocks":
+		p["type"] = "ss"
+		p["cipher"] = yamlString(ob, "method")
+		p["password"] = yamlString(ob, "password")
+		if detour := yamlMap(ob, "detour"); detour != nil {
+			return p, clashFromShadowTLS(p, detour)
+		}
+		return p, clashFromPlugin(p, yamlString(ob, "plugin"), yamlString(ob, "plugin_opts"))
+	case "socks":
+		if yamlString(ob, "version") != "" && yamlString(ob, "version") != "5" {
+			return nil, fmt.Errorf("export: clash: %w: socks%s", ErrUnsupportedScheme, yamlString(ob, "version"))
+		}
+		p["type"] = "socks5"
+		copyCredentials(p, ob)
+		return p, nil
+	case "http":
+		p["type"] = "http"
+		delete(p, "udp")
+		copyCredentials(p, ob)
+		clashFromTLS(p, tls, "sni")
+		return p, nil
+	case "anytls":
+		p["type"] = "anytls"
+		p["password"] = yamlString(ob, "password")
+		clashFromTLS(p, tls, "sni")
+		delete(p, "tls")
+		return p, nil
+	case "hysteria2":
+		p["type"] = "hysteria2"
+		if pw := yamlString(ob, "password"); pw != "" {
+			p["password"] = pw
+		}
+		if ranges := hysteria2HopPorts(ob); len(ranges) > 0 {
+			p["ports"] = strings.Join(ranges, ",")
+		}
+		if up := yamlInt(ob, "up_mbps"); up > 0 {
+			p["up"] = strconv.Itoa(up) + " Mbps"
+		}
+		if down := yamlInt(ob, "down_mbps"); down > 0 {
+			p["down"] = strconv.Itoa(down) + " Mbps"
+		}
+		if obfs := yamlMap(ob, "obfs"); obfs != nil {
+			p["obfs"] = yamlString(obfs, "type")
+			p["obfs-password"] = yamlString(obfs, "password")
+		}
+		clashFromTLS(p, tls, "sni")
+		delete(p, "tls")
+		return p, nil
+	case "tuic":
+		p["type"] = "tuic"
+		p["uuid"] = yamlString(ob, "uuid")
+		p["password"] = yamlString(ob, "password")
+		if cc := yamlString(ob, "congestion_control"); cc != "" {
+			p["congestion-controller"] = cc
+		}
+		if mode := yamlString(ob, "udp_relay_mode"); mode != "" {
+			p["udp-relay-mode"] = mode
+		}
+		if yamlBool(ob, "zero_rtt_handshake") {
+			p["reduce-rtt"] = true
+		}
+		if hb := yamlString(ob, "heartbeat"); hb != "" {
+			if d, err := time.ParseDuration(hb); err == nil {
+				p["heartbeat-interval"] = int(d.Milliseconds())
+			}
+		}
+		if yamlBool(tls, "disable_sni") {
+			p["disable-sni"] = true
+		}
+		clashFromTLS(p, tls, "sni")
+		delete(p, "tls")
+		return p, nil
+	default:
+		return nil, fmt.Errorf("export: clash: %w: %s", ErrUnsupportedScheme, typ)
+	}
+}
+
+func clashFromTLS(p map[string]any, tls map[string]any, sniKey string) {
+	if !yamlBool(tls, "enabled") {
+		return
+	}
+	p["tls"] = true
+	if sni := yamlString(tls, "server_name"); sni != "" {
+		p[sniKey] = sni
+	}
+	if yamlBool(tls, "insecure") {
+		p["skip-cert-verify"] = true
+	}
+	if alpn := yamlStrings(tls, "alpn"); len(alpn) > 0 {
+		p["alpn"] = alpn
+	}
+	if fp := yamlString(yamlMap(tls, "utls"), "fingerprint"); fp != "" {
+		p["client-fingerprint"] = fp
+	}
+	if config := echConfigBase64(yamlMap(tls, "ech")); config != "" {
+		p["ech-opts"] = map[string]any{"enable": true, "config": config}
+	}
+	if reality := yamlMap(tls, "reality"); yamlBool(reality, "enabled") {
+		opts := map[string]any{"public-key": yamlString(reality, "public_key")}
+		if sid := yamlString(reality, "short_id"); sid != "" {
+			opts["short-id"] = sid
+		}
+		p["reality-opts"] = opts
+	}
+}
+
+// clashFromTransport переносит транспорт в network/*-opts. http-транспорт с method — маскировка tcp
+// под HTTP/1.1 (network: http), без него — h2.
+func clashFromTransport(p map[string]any, t map[string]any) error {
+	if t == nil {
+		return nil
+	}
+	switch typ := yamlString(t, "type"); typ {
+	case "ws", "httpupgrade":
+		opts := map[string]any{}
+		if path := yamlString(t, "path"); path != "" {
+			opts["path"] = path
+		}
+		if host := transportHost(t); host != "" {
+			opts["headers"] = map[string]any{"Host": host}
+		}
+		if typ == "httpupgrade" {
+			opts["v2ray-http-upgrade"] = true
+		} else {
+			if ed := yamlInt(t, "max_early_data"); ed > 0 {
+				opts["max-early-data"] = ed
+			}
+			if name := yamlString(t, "early_data_header_name"); name != "" {
+				opts["early-data-header-name"] = name
+			}
+		}
+		p["network"] = "ws"
+		p["ws-opts"] = opts
+	case "grpc":
+		p["network"] = "grpc"
+		p["grpc-opts"] = map[string]any{"grpc-service-name": yamlString(t, "service_name")}
+	case "http":
+		hosts, path := yamlStrings(t, "host"), yamlString(t, "path")
+		if method := yamlString(t, "method"); method != "" {
+			// В http-opts путь — список, а хосты — заголовок Host.
+			opts := map[string]any{"method": method}
+			if path != "" {
+				opts["path"] = []string{path}
+			}
+			if len(hosts) > 0 {
+				opts["headers"] = map[string]any{"Host": hosts}
+			}
+			p["network"] = "http"
+			p["http-opts"] = opts
+			return nil
+		}
+		opts := map[string]any{}
+		if len(hosts) > 0 {
+			opts["host"] = hosts
+		}
+		if path != "" {
+			opts["path"] = path
+		}
+		p["network"] = "h2"
+		p["h2-opts"] = opts
+	default:
+		return fmt.Errorf("export: clash: %w: %s", ErrUnsupportedTransport, typ)
+	}
+	return nil
+}
+
+// clashFromPlugin — обратное к clashShadowsocks: SIP003 опции "obfs=http;obfs-host=…" в plugin-opts.
+func clashFromPlugin(p map[string]any, plugin, opts string) error {
+	if plugin == "" {
+		return nil
+	}
+	values := map[string]string{}
+	for _, part := range strings.Split(opts, ";") {
+		if k, v, _ := strings.Cut(strings.TrimSpace(part), "="); k != "" {
+			values[k] = v
+		}
+	}
+	out := map[string]any{}
+	switch plugin {
+	case "obfs-local":
+		p["plugin"] = "obfs"
+		if mode := values["obfs"]; mode != "" {
+			out["mode"] = mode
+		}
+		if host := values["obfs-host"]; host != "" {
+			out["host"] = host
+		}
+	case "v2ray-plugin":
+		p["plugin"] = "v2ray-plugin"
+		out["mode"] = "websocket"
+		if mode := values["mode"]; mode != "" {
+			out["mode"] = mode
+		}
+		if _, ok := values["tls"]; ok {
+			out["tls"] = true
+		}
+		if host := values["host"]; host != "" {
+			out["host"] = host
+		}
+		if path := values["path"]; path != "" {
+			out["path"] = path
+		}
+		if values["mux"] == "1" || values["mux"] == "true" {
+			out["mux"] = true
+		}
+	default:
+		return fmt.Errorf("export: clash: shadowsocks: %w: plugin %s", ErrUnsupportedTransport, plugin)
+	}
+	p["plugin-opts"] = out
+	return nil
+}
+
+// clashFromShadowTLS — shadowsocks поверх ShadowTLS в Clash описывается плагином shadow-tls.
+func clashFromShadowTLS(p map[string]any, detour map[string]any) error {
+	if yamlString(detour, "type") != "shadowtls" {
+		return fmt.Errorf("export: clash: shadowsocks: %w: detour %s", ErrUnsupportedTransport, yamlString(detour, "type"))
+	}
+	tls := yamlMap(detour, "tls")
+	opts := map[string]any{
+		"host":    yamlString(tls, "server_name"),
+		"version": yamlInt(detour, "version"),
+	}
+	if pw := yamlString(detour, "password"); pw != "" {
+		opts["password"] = pw
+	}
+	p["plugin"] = "shadow-tls"
+	p["plugin-opts"] = opts
+	if fp := yamlString(yamlMap(tls, "utls"), "fingerprint"); fp != "" {
+		p["client-fingerprint"] = fp
+	}
+	return nil
+}
+
+func clashFromWireGuard(name string, ob map[string]any) (map[string]any, error) {
+	peers := yamlMaps(ob, "peers")
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("export: clash: wireguard: missing peer")
+	}
+	peer := peers[0]
+	p := map[string]any{
+		"name":        name,
+		"type":        "wireguard",
+		"server":      yamlString(peer, "address"),
+		"port":        yamlInt(peer, "port"),
+		"private-key": yamlString(ob, "private_key"),
+		"public-key":  yamlString(peer, "public_key"),
+		"udp":         true,
+	}
+	for _, a := range yamlStrings(ob, "address") {
+		ip, _, _ := strings.Cut(a, "/")
+		key := "ip"
+		if strings.Contains(ip, ":") {
+			key = "ipv6"
+		}
+		if _, ok := p[key]; !ok {
+			p[key] = ip
+		}
+	}
+	if psk := yamlString(peer, "pre_shared_key"); psk != "" {
+		p["pre-shared-key"] = psk
+	}
+	if allowed := yamlStrings(peer, "allowed_ips"); len(allowed) > 0 {
+		p["allowed-ips"] = allowed
+	}
+	if reserved := yamlInts(peer, "reserved"); len(reserved) == 3 {
+		p["reserved"] = reserved
+	}
+	if mtu := yamlInt(ob, "mtu"); mtu > 0 {
+		p["mtu"] = mtu
+	}
+	return p, nil
+}
+
+// clashKeyOrder — ключи, которые идут первыми в каждом прокси (как их пишут руками), остальные — по алфавиту.
+var clashKeyOrder = map[string]int{"name": 1, "type": 2, "server": 3, "port": 4}
+
+// EncodeClash собирает Clash/Mihomo YAML с единственным разделом proxies.
+func EncodeClash(proxies []map[string]any) ([]byte, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, p := range proxies {
+		var node yaml.Node
+		if err := node.Encode(p); err != nil {
+			return nil, err
+		}
+		pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			a, b := clashKeyOrder[pairs[i][0].Value], clashKeyOrder[pairs[j][0].Value]
+			return a != 0 && (b == 0 || a < b)
+		})
+		node.Content = node.Content[:0]
+		for _, kv := range pairs {
+			node.Content = append(node.Content, kv[0], kv[1])
+		}
+		list.Content = append(list.Content, &node)
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "proxies"},
+		list,
+	}}
+	return yaml.Marshal(doc)
+}
+
+// shadowTLSPluginOpts — опции плагина shadow-tls в ss-ссылке (host, password, version), как их пишет Clash.
+func shadowTLSPluginOpts(detour map[string]any) string {
+	opts := []string{"host=" + yamlString(yamlMap(detour, "tls"), "server_name")}
+	if pw := yamlString(detour, "password"); pw != "" {
+		opts = append(opts, "password="+pw)
+	}
+	if v := yamlInt(detour, "version"); v > 0 {
+		opts = append(opts, "version="+strconv.Itoa(v))
+	}
+	return strings.Join(opts, ";")
+}
+
+// proxyUserinfo — user:pass socks/http/naive ссылки (nil, если учётных данных нет).
+func proxyUserinfo(ob map[string]any) *url.Userinfo {
+	user, pw := yamlString(ob, "username"), yamlString(ob, "password")
+	switch {
+	case pw != "":
+		return url.UserPassword(user, pw)
+	case user != "":
+		return url.User(user)
+	}
+	return nil
+}
+
+func joinHostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// yamlMaps — список объектов (peers и т.п.) из JSON/YAML ([]any) или собранный в Go ([]map[string]any).
+func yamlMaps(m map[string]any, key string) []map[string]any {
+	switch v := m[key].(type) {
+	case []map[string]any:
+		return v
+	case []any:
+		out := make([]map[string]any, 0, len(v))
+		for _, item := range v {
+			if mm, ok := item.(map[string]any); ok {
+				out = append(out, mm)
+			}
+		}
+		return out
+	}
+	return nil
+}
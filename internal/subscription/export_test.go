@@ -0,0 +1,19 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExportDetourChain(t *testing.T) {
+	ob := map[string]any{
+		"type": "shadowsocks", "server": "5.6.7.8", "server_port": 8388,
+		"method": "aes-256-gcm", "password": "secret", "detour": "shadowsocks-0123456789ab",
+	}
+	if uri, err := OutboundToURI("exit", ob); !errors.Is(err, ErrDetourChain) {
+		t.Errorf("OutboundToURI = %q, %v; want ErrDetourChain", uri, err)
+	}
+	if p, err := OutboundToClash("exit", ob); !errors.Is(err, ErrDetourChain) {
+		t.Errorf("OutboundToClash = %v, %v; want ErrDetourChain", p, err)
+	}
+}
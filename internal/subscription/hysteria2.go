@@ -0,0 +1,35 @@
+package subscription
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hysteria2ServerPorts — server_ports hysteria2 вместе с основным портом. При server_ports sing-box подключается
+// только к портам из списка и server_port не использует, поэтому основной порт добавляется в начало,
+// если ни один диапазон его не покрывает — иначе он пропал бы из перебора. Общее для hy2:// ссылок и Clash.
+func Hysteria2ServerPorts(port int, ranges []string) []string {
+	if len(ranges) == 0 || portInRanges(port, ranges) {
+		return ranges
+	}
+	return append([]string{PortRange(port)}, ranges...)
+}
+
+// PortRange — одиночный порт в формате server_ports ("443:443").
+func PortRange(port int) string {
+	return fmt.Sprintf("%d:%d", port, port)
+}
+
+// portInRanges — входит ли порт в один из диапазонов server_ports.
+func portInRanges(port int, ranges []string) bool {
+	for _, r := range ranges {
+		from, to, _ := strings.Cut(r, ":")
+		start, _ := strconv.Atoi(from)
+		end, _ := strconv.Atoi(to)
+		if port >= start && port <= end {
+			return true
+		}
+	}
+	return false
+}
@@ -2,29 +2,71 @@ package subscription
 
 import (
 	"encoding/base64"
+	"fmt"
 	"net/url"
-	"strconv"
 	"strings"
 
 	"github.com/GalitskyKK/nekkus-net/internal/store"
 )
 
-// ParseContent парсит тело подписки (сырой или base64) и возвращает список серверов.
+// ParseContent парсит тело подписки (сырой или base64 список URI, sing-box JSON или один его outbound, SIP008, Clash YAML, wg-quick .conf) и возвращает список серверов.
+// ID узлов — стабильные отпечатки (см. Fingerprint), узлы с одинаковыми именами сохраняются под разными именами.
 func ParseContent(body string) ([]store.ServerNode, error) {
+	nodes, _, err := ParseContentReport(body, nil)
+	return nodes, err
+}
+
+// parseNodes разбирает тело в узлы (без ID) и записывает исход каждой строки в rep.
+func parseNodes(body string, rep *Report) ([]store.ServerNode, error) {
 	content := strings.TrimSpace(body)
 	if content == "" {
+		rep.setFormat(FormatURIList)
 		return nil, nil
 	}
+	// Готовый конфиг sing-box (Marzban, Hiddify и др.) — берём outbounds как есть.
+	if isSingBoxJSON(content) {
+		rep.setFormat(FormatSingBox)
+		return parseSingBoxJSON(content, rep)
+	}
+	// Один outbound sing-box ({"type": "vless", ...}) — например, вставленный вручную.
+	if isSingBoxOutbound(content) {
+		rep.setFormat(FormatSingBox)
+		return parseSingBoxOutbound(content, rep)
+	}
+	// SIP008 (Shadowsocks online config) — превращаем в SIP002 ss:// ссылки.
+	if isSIP008JSON(content) {
+		rep.setFormat(FormatSIP008)
+		lines, err := sip008ToURIs(content, rep)
+		if err != nil {
+			return nil, err
+		}
+		return urisToServerNodes(lines, rep), nil
+	}
+	// Clash/Mihomo YAML (proxies:) — узлы сразу с sing-box outbound.
+	if isClashYAML(content) {
+		rep.setFormat(FormatClash)
+		return parseClashYAML(content, rep)
+	}
+	// wg-quick конфиг (.conf) — превращаем в wireguard:// ссылки (несколько пиров — в готовый endpoint).
+	if isWireGuardConf(content) {
+		rep.setFormat(FormatWireGuard)
+		return parseWireGuardConf(content, rep)
+	}
 	// Сначала как plain list URI по строкам
-	uris := extractURIList(content)
+	rep.setFormat(FormatURIList)
+	uris, other := extractURIList(content)
 	if len(uris) == 0 {
 		decoded, err := tryDecodeBase64(content)
 		if err != nil {
-			return nil, nil
+			return nil, fmt.Errorf("subscription is neither a list of links, base64, nor a known config format")
 		}
-		uris = extractURIList(decoded)
+		rep.setFormat(FormatBase64)
+		uris, other = extractURIList(decoded)
+	}
+	for _, l := range other {
+		rep.add(l.num, l.text, -1, fmt.Errorf("not a share link"))
 	}
-	return urisToServerNodes(uris), nil
+	return urisToServerNodes(uris, rep), nil
 }
 
 func tryDecodeBase64(input string) (string, error) {
@@ -43,47 +85,38 @@ func tryDecodeBase64(input string) (string, error) {
 	return "", err
 }
 
-func extractURIList(content string) []string {
-	lines := strings.Split(content, "\n")
-	result := make([]string, 0, len(lines))
-	for _, line := range lines {
+// sourceLine — строка тела подписки с её номером (для отчёта о разборе).
+type sourceLine struct {
+	num  int
+	text string
+}
+
+// extractURIList делит тело на строки-ссылки (со "://") и прочие непустые строки.
+func extractURIList(content string) (uris, other []sourceLine) {
+	for i, line := range strings.Split(content, "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
 		if strings.Contains(line, "://") {
-			result = append(result, line)
+			uris = append(uris, sourceLine{num: i + 1, text: line})
+		} else {
+			other = append(other, sourceLine{num: i + 1, text: line})
 		}
 	}
-	return result
+	return uris, other
 }
 
-func urisToServerNodes(uris []string) []store.ServerNode {
-	seen := make(map[string]bool)
-	out := make([]store.ServerNode, 0, len(uris))
-	for i, raw := range uris {
-		name := extractNameFromURI(raw)
-		name = strings.TrimSpace(name)
-		if name == "" {
-			name = "server-" + strconv.Itoa(i+1)
-		}
-		key := strings.ToLower(name)
-		if seen[key] {
-			continue
-		}
-		seen[key] = true
-		addr := extractHostFromURI(raw)
-		id := name
-		if addr != "" {
-			id = name + "-" + addr
-		}
+func urisToServerNodes(lines []sourceLine, rep *Report) []store.ServerNode {
+	out := make([]store.ServerNode, 0, len(lines))
+	for _, l := range lines {
+		rep.add(l.num, l.text, len(out), nil)
 		out = append(out, store.ServerNode{
-			ID:      id,
-			Name:    name,
-			Address: addr,
+			Name:    extractNameFromURI(l.text),
+			Address: extractHostFromURI(l.text),
 			Country: "",
 			Ping:    0,
-			URI:     raw,
+			URI:     l.text,
 		})
 	}
 	return out
@@ -116,10 +149,10 @@ func extractNameFromURI(raw string) string {
 func extractHostFromURI(raw string) string {
 	parsed, err := url.Parse(raw)
 	if err != nil {
-		return ""
+		return extractHostFallback(raw)
 	}
 	if parsed.Host != "" {
-		if host, _, _ := strings.Cut(parsed.Host, ":"); host != "" {
+		if host := parsed.Hostname(); host != "" {
 			return host
 		}
 		return parsed.Host
@@ -137,3 +170,25 @@ func extractHostFromURI(raw string) string {
 	}
 	return ""
 }
+
+// extractHostFallback достаёт хост вручную, когда url.Parse не справился
+// (например, hysteria2 с диапазоном портов: hy2://pass@host:20000-30000).
+func extractHostFallback(raw string) string {
+	_, rest, ok := strings.Cut(raw, "://")
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+	if strings.HasPrefix(rest, "[") {
+		if end := strings.Index(rest, "]"); end > 0 {
+			return rest[1:end]
+		}
+	}
+	host, _, _ := strings.Cut(rest, ":")
+	return host
+}
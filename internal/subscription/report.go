@@ -0,0 +1,167 @@
+package subscription
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// Ошибки-классы для отчёта о разборе: проверки узлов (в том числе vpn.ValidateServer) оборачивают их через %w.
+var (
+	ErrUnsupportedScheme    = errors.New("unsupported scheme")
+	ErrUnsupportedTransport = errors.New("unsupported transport")
+)
+
+// LineStatus — исход разбора одной строки (или элемента proxies/outbounds/servers) подписки.
+type LineStatus string
+
+const (
+	LineAccepted             LineStatus = "accepted"
+	LineUnsupportedScheme    LineStatus = "unsupported_scheme"
+	LineUnsupportedTransport LineStatus = "unsupported_transport"
+	LineMalformed            LineStatus = "malformed"
+)
+
+// Форматы тела подписки (Report.Format).
+const (
+	FormatURIList   = "uri_list"
+	FormatBase64    = "base64"
+	FormatSingBox   = "sing-box"
+	FormatSIP008    = "sip008"
+	FormatClash     = "clash"
+	FormatWireGuard = "wireguard"
+	// FormatStored — отчёт построен по сохранённому списку серверов, а не по телу подписки.
+	FormatStored = "stored"
+)
+
+// maxReportText — сколько символов исходной строки хранить в отчёте.
+const maxReportText = 300
+
+// LineReport — исход одной строки. Line — номер строки (для структурированных форматов — номер элемента), с 1.
+type LineReport struct {
+	Line   int        `json:"line"`
+	Text   string     `json:"text,omitempty"`
+	Name   string     `json:"name,omitempty"`
+	NodeID string     `json:"node_id,omitempty"`
+	Status LineStatus `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+	// Warnings — замечания к принятой строке: узел рабочий, но часть параметров ссылки пропущена.
+	Warnings []string `json:"warnings,omitempty"`
+
+	node int // индекс узла в результате разбора; -1 — узла нет
+}
+
+// Report — построчный отчёт о разборе подписки.
+type Report struct {
+	Format   string       `json:"format"`
+	Lines    []LineReport `json:"lines"`
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	// Error — почему тело не удалось разобрать целиком (тогда Lines может быть пустым).
+	Error string `json:"error,omitempty"`
+}
+
+// Check проверяет, сможет ли движок подключиться к узлу: err отклоняет строку отчёта,
+// warnings (при err == nil) дописываются к принятой строке.
+type Check func(store.ServerNode) (warnings []string, err error)
+
+// ParseContentReport — как ParseContent, но вдобавок возвращает отчёт по каждой строке.
+// validate (может быть nil) проверяет узлы; её ошибки и предупреждения попадают в отчёт.
+// Отклонённые validate узлы всё равно возвращаются — отчёт только объясняет, почему их не видно.
+func ParseContentReport(body string, validate Check) ([]store.ServerNode, *Report, error) {
+	rep := &Report{Lines: []LineReport{}}
+	nodes, err := parseNodes(body, rep)
+	if err != nil {
+		rep.Error = err.Error()
+		rep.count()
+		return nil, rep, err
+	}
+	nodes = DetectCountries(AssignIDs(nodes))
+	resolveDetourRefs(nodes)
+	for i := range rep.Lines {
+		l := &rep.Lines[i]
+		if l.node < 0 {
+			continue
+		}
+		n := nodes[l.node]
+		l.Name, l.NodeID = n.Name, n.ID
+		l.check(n, validate)
+	}
+	sort.SliceStable(rep.Lines, func(i, j int) bool { return rep.Lines[i].Line < rep.Lines[j].Line })
+	rep.count()
+	return nodes, rep, nil
+}
+
+// ReportFromServers строит отчёт по уже сохранённым серверам (когда тело подписки под рукой нет).
+func ReportFromServers(servers []store.ServerNode, validate Check) *Report {
+	rep := &Report{Format: FormatStored, Lines: make([]LineReport, 0, len(servers))}
+	for i, n := range servers {
+		l := LineReport{Line: i + 1, Text: n.URI, Name: n.Name, NodeID: n.ID, Status: LineAccepted, node: -1}
+		l.check(n, validate)
+		l.Text = truncateText(l.Text)
+		rep.Lines = append(rep.Lines, l)
+	}
+	rep.count()
+	return rep
+}
+
+// add записывает строку в отчёт. node — индекс узла или -1; err — причина отказа (nil — принята).
+func (r *Report) add(line int, text string, node int, err error) {
+	if r == nil {
+		return
+	}
+	l := LineReport{Line: line, Text: truncateText(text), Status: LineAccepted, node: node}
+	if err != nil {
+		l.reject(err)
+	}
+	r.Lines = append(r.Lines, l)
+}
+
+func (r *Report) setFormat(format string) {
+	if r != nil {
+		r.Format = format
+	}
+}
+
+func (r *Report) count() {
+	r.Accepted, r.Rejected = 0, 0
+	for _, l := range r.Lines {
+		if l.Status == LineAccepted {
+			r.Accepted++
+		} else {
+			r.Rejected++
+		}
+	}
+}
+
+func (l *LineReport) check(n store.ServerNode, validate Check) {
+	if validate == nil {
+		return
+	}
+	warnings, err := validate(n)
+	if err != nil {
+		l.reject(err)
+		return
+	}
+	l.Warnings = warnings
+}
+
+func (l *LineReport) reject(err error) {
+	l.Reason = err.Error()
+	switch {
+	case errors.Is(err, ErrUnsupportedScheme):
+		l.Status = LineUnsupportedScheme
+	case errors.Is(err, ErrUnsupportedTransport):
+		l.Status = LineUnsupportedTransport
+	default:
+		l.Status = LineMalformed
+	}
+}
+
+func truncateText(s string) string {
+	if r := []rune(s); len(r) > maxReportText {
+		return string(r[:maxReportText]) + "…"
+	}
+	return s
+}
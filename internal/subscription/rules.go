@@ -0,0 +1,223 @@
+package subscription
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// RuleResult — исход применения правил к одному узлу (для предпросмотра).
+type RuleResult struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	OriginalName string `json:"original_name"`
+	Host         string `json:"host,omitempty"`
+	Protocol     string `json:"protocol"`
+	// Reason — почему узел отброшен: "include" (не подошёл ни под одно правило), "exclude: <pattern>"
+	// или "detour: <имя>" (подключается через отброшенный узел этой же подписки).
+	Reason string `json:"reason,omitempty"`
+}
+
+// RulesPreview — какие узлы правила оставят и какие отбросят.
+type RulesPreview struct {
+	Kept    []RuleResult `json:"kept"`
+	Dropped []RuleResult `json:"dropped"`
+}
+
+type compiledRule struct {
+	field   string
+	pattern string
+	re      *regexp.Regexp
+}
+
+// ValidateRules проверяет поля и регулярные выражения правил.
+func ValidateRules(rules store.SubscriptionRules) error {
+	_, _, err := compileRules(rules)
+	return err
+}
+
+// ApplyRules фильтрует и переименовывает узлы. ID не меняются; имена после переименования
+// снова разводятся, как в AssignIDs. nil-правила возвращают список как есть.
+func ApplyRules(nodes []store.ServerNode, rules *store.SubscriptionRules) ([]store.ServerNode, error) {
+	if rules == nil {
+		return nodes, nil
+	}
+	kept, _, err := applyRules(nodes, *rules)
+	return kept, err
+}
+
+// PreviewRules показывает, что оставят правила, ничего не сохраняя.
+func PreviewRules(nodes []store.ServerNode, rules store.SubscriptionRules) (*RulesPreview, error) {
+	kept, dropped, err := applyRules(nodes, rules)
+	if err != nil {
+		return nil, err
+	}
+	original := make(map[string]store.ServerNode, len(nodes))
+	for _, n := range nodes {
+		original[n.ID] = n
+	}
+	p := &RulesPreview{Kept: make([]RuleResult, 0, len(kept)), Dropped: dropped}
+	for _, n := range kept {
+		r := ruleResult(original[n.ID])
+		r.Name = n.Name
+		p.Kept = append(p.Kept, r)
+	}
+	return p, nil
+}
+
+func applyRules(nodes []store.ServerNode, rules store.SubscriptionRules) ([]store.ServerNode, []RuleResult, error) {
+	include, exclude, err := compileRules(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	kept := make([]store.ServerNode, 0, len(nodes))
+	dropped := []RuleResult{}
+	for _, n := range nodes {
+		if len(include) > 0 && matchRule(include, n) == nil {
+			r := ruleResult(n)
+			r.Reason = "include"
+			dropped = append(dropped, r)
+			continue
+		}
+		if rule := matchRule(exclude, n); rule != nil {
+			r := ruleResult(n)
+			r.Reason = "exclude: " + rule.pattern
+			dropped = append(dropped, r)
+			continue
+		}
+		kept = append(kept, n)
+	}
+	kept, dropped = dropDetourDependants(nodes, kept, dropped)
+	if rules.Rename == "" && rules.Prefix == "" {
+		return kept, dropped, nil
+	}
+	names := make(map[string]bool, len(kept))
+	for i := range kept {
+		n := &kept[i]
+		name := n.Name
+		if rules.Rename != "" {
+			name = strings.TrimSpace(renameNode(rules.Rename, *n, i+1))
+			if name == "" {
+				name = n.Name
+			}
+		}
+		n.Name = uniqueValue(rules.Prefix+name, " (%d)", names, true)
+	}
+	return kept, dropped, nil
+}
+
+// dropDetourDependants отбрасывает вслед за узлом те, что подключаются через него (detour — его ID):
+// без него они не подключились бы. Ссылки на серверы вне подписки не трогаются.
+func dropDetourDependants(nodes, kept []store.ServerNode, dropped []RuleResult) ([]store.ServerNode, []RuleResult) {
+	names := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		names[n.ID] = n.Name
+	}
+	gone := make(map[string]bool, len(dropped))
+	for _, r := range dropped {
+		gone[r.ID] = true
+	}
+	for changed := len(gone) > 0; changed; {
+		changed = false
+		rest := kept[:0]
+		for _, n := range kept {
+			if detour, _ := n.Outbound["detour"].(string); gone[detour] {
+				r := ruleResult(n)
+				r.Reason = "detour: " + names[detour]
+				dropped = append(dropped, r)
+				gone[n.ID] = true
+				changed = true
+				continue
+			}
+			rest = append(rest, n)
+		}
+		kept = rest
+	}
+	return kept, dropped
+}
+
+func compileRules(rules store.SubscriptionRules) (include, exclude []compiledRule, err error) {
+	if include, err = compileRuleList(rules.Include); err != nil {
+		return nil, nil, fmt.Errorf("include: %w", err)
+	}
+	if exclude, err = compileRuleList(rules.Exclude); err != nil {
+		return nil, nil, fmt.Errorf("exclude: %w", err)
+	}
+	return include, exclude, nil
+}
+
+func compileRuleList(list []store.FilterRule) ([]compiledRule, error) {
+	out := make([]compiledRule, 0, len(list))
+	for _, r := range list {
+		field := strings.ToLower(strings.TrimSpace(r.Field))
+		switch field {
+		case "":
+			field = "name"
+		case "name", "host", "protocol", "country":
+		default:
+			return nil, fmt.Errorf("unknown field: %s", r.Field)
+		}
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("empty pattern")
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, compiledRule{field: field, pattern: r.Pattern, re: re})
+	}
+	return out, nil
+}
+
+// matchRule возвращает первое правило, под которое подходит узел, или nil.
+func matchRule(rules []compiledRule, n store.ServerNode) *compiledRule {
+	for i := range rules {
+		var value string
+		switch rules[i].field {
+		case "host":
+			value = n.Address
+		case "protocol":
+			value = NodeProtocol(n)
+		case "country":
+			value = n.Country
+		default:
+			value = n.Name
+		}
+		if rules[i].re.MatchString(value) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func renameNode(template string, n store.ServerNode, index int) string {
+	return strings.NewReplacer(
+		"{name}", n.Name,
+		"{host}", n.Address,
+		"{protocol}", NodeProtocol(n),
+		"{index}", strconv.Itoa(index),
+		"{country}", n.Country,
+	).Replace(template)
+}
+
+func ruleResult(n store.ServerNode) RuleResult {
+	return RuleResult{
+		ID:           n.ID,
+		Name:         n.Name,
+		OriginalName: n.Name,
+		Host:         n.Address,
+		Protocol:     NodeProtocol(n),
+	}
+}
+
+// NodeProtocol — протокол узла в терминах sing-box (vless, vmess, shadowsocks, hysteria2, wireguard…).
+func NodeProtocol(n store.ServerNode) string {
+	proto, _ := fingerprintKey(n)
+	if proto == "ss" {
+		return "shadowsocks"
+	}
+	return proto
+}
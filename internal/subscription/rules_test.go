@@ -0,0 +1,48 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// Узел, подключающийся через отброшенный правилами узел, отбрасывается вместе с ним (и дальше по цепочке).
+func TestRulesDropDetourDependants(t *testing.T) {
+	body := `{"outbounds": [
+		{"type": "shadowsocks", "tag": "hop", "server": "1.2.3.4", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret"},
+		{"type": "shadowsocks", "tag": "exit", "server": "5.6.7.8", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret", "detour": "hop"},
+		{"type": "shadowsocks", "tag": "last", "server": "9.9.9.9", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret", "detour": "exit"},
+		{"type": "shadowsocks", "tag": "direct one", "server": "8.8.8.8", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret"}
+	]}`
+	nodes, err := ParseContent(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := store.SubscriptionRules{Exclude: []store.FilterRule{{Pattern: "^hop$"}}}
+
+	kept, err := ApplyRules(nodes, &rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].Name != "direct one" {
+		t.Errorf("kept = %v, want only the direct node", kept)
+	}
+
+	preview, err := PreviewRules(nodes, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"hop": "exclude: ^hop$", "exit": "detour: hop", "last": "detour: exit"}
+	if len(preview.Dropped) != len(want) {
+		t.Fatalf("dropped = %+v, want %d nodes", preview.Dropped, len(want))
+	}
+	for _, r := range preview.Dropped {
+		if r.Reason != want[r.Name] {
+			t.Errorf("%s: reason = %q, want %q", r.Name, r.Reason, want[r.Name])
+		}
+	}
+}
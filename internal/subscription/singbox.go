@@ -0,0 +1,237 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// singBoxServiceTypes — служебные outbound sing-box, которые не являются серверами.
+var singBoxServiceTypes = map[string]bool{
+	"selector": true,
+	"urltest":  true,
+	"direct":   true,
+	"block":    true,
+	"dns":      true,
+}
+
+// isSingBoxJSON — похоже ли тело на конфиг sing-box (JSON-объект с outbounds или endpoints).
+func isSingBoxJSON(content string) bool {
+	if !strings.HasPrefix(content, "{") {
+		return false
+	}
+	var probe struct {
+		Outbounds json.RawMessage `json:"outbounds"`
+		Endpoints json.RawMessage `json:"endpoints"`
+	}
+	if err := json.Unmarshal([]byte(content), &probe); err != nil {
+		return false
+	}
+	return len(probe.Outbounds) > 0 || len(probe.Endpoints) > 0
+}
+
+// parseSingBoxJSON импортирует каждый прокси-outbound (и endpoint) конфига sing-box как узел.
+// Outbound сохраняется как есть; tag становится именем узла, при подключении заменяется на "proxy".
+// Номер строки в отчёте — номер элемента в outbounds, затем в endpoints; служебные outbound в отчёт не попадают.
+func parseSingBoxJSON(content string, rep *Report) ([]store.ServerNode, error) {
+	var doc struct {
+		Outbounds []map[string]any `json:"outbounds"`
+		Endpoints []map[string]any `json:"endpoints"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("sing-box json: %w", err)
+	}
+	all := append(doc.Outbounds, doc.Endpoints...)
+	wrappers := shadowTLSWrappers(all)
+	byTag := make(map[string]int, len(all))
+	for i, ob := range all {
+		if tag, _ := ob["tag"].(string); tag != "" {
+			if _, dup := byTag[tag]; !dup {
+				byTag[tag] = i
+			}
+		}
+	}
+	servers := make([]bool, len(all))
+	for i, ob := range all {
+		typ, _ := ob["type"].(string)
+		name, _ := ob["tag"].(string)
+		servers[i] = typ != "" && !singBoxServiceTypes[typ] && wrappers[name] == nil
+	}
+	// Узел, чей detour не воспроизвести (служебный outbound, неизвестный tag или пропущенный узел), пропускается:
+	// без detour он подключался бы напрямую, а не так, как задумано в конфиге.
+	skipped := make([]error, len(all))
+	for changed := true; changed; {
+		changed = false
+		for i, ob := range all {
+			if !servers[i] || skipped[i] != nil {
+				continue
+			}
+			j, err := singBoxDetour(ob, all, byTag, wrappers)
+			if err == nil && j >= 0 && skipped[j] != nil {
+				err = fmt.Errorf("sing-box: detour %q is skipped", all[j]["tag"])
+			}
+			if err != nil {
+				skipped[i] = err
+				changed = true
+			}
+		}
+	}
+	index := make([]int, len(all))
+	n := 0
+	for i := range all {
+		index[i] = -1
+		if servers[i] && skipped[i] == nil {
+			index[i] = n
+			n++
+		}
+	}
+
+	out := make([]store.ServerNode, 0, n)
+	for i, ob := range all {
+		typ, _ := ob["type"].(string)
+		name, _ := ob["tag"].(string)
+		if typ == "" {
+			rep.add(i+1, name, -1, fmt.Errorf("sing-box: outbound without type"))
+			continue
+		}
+		if !servers[i] {
+			continue
+		}
+		if skipped[i] != nil {
+			rep.add(i+1, name, -1, skipped[i])
+			continue
+		}
+		rep.add(i+1, name, len(out), nil)
+		// detour ссылается на tag из исходного конфига, которого в нашем конфиге не будет.
+		// ShadowTLS под shadowsocks вкладываем в detour целиком — без него узел не подключится;
+		// другой сервер конфига становится ссылкой на его узел (ID выдаются позже, см. resolveDetourRefs).
+		detourTag, _ := ob["detour"].(string)
+		if wrapper := wrappers[detourTag]; wrapper != nil {
+			ob["detour"] = wrapper
+		} else if j, _ := singBoxDetour(ob, all, byTag, wrappers); j >= 0 {
+			ob["detour"] = detourRef(index[j])
+		} else {
+			delete(ob, "detour")
+		}
+		out = append(out, store.ServerNode{
+			Name:     name,
+			Address:  singBoxServerAddress(ob),
+			Outbound: ob,
+		})
+	}
+	return out, nil
+}
+
+// singBoxDetour — куда ведёт detour outbound: индекс другого сервера в all или -1, если цепочки нет
+// (detour не задан, ведёт на direct или на обёртку ShadowTLS). Ошибка — цепочку не воспроизвести.
+func singBoxDetour(ob map[string]any, all []map[string]any, byTag map[string]int, wrappers map[string]map[string]any) (int, error) {
+	tag, _ := ob["detour"].(string)
+	if tag == "" || wrappers[tag] != nil {
+		return -1, nil
+	}
+	j, ok := byTag[tag]
+	if !ok {
+		return -1, fmt.Errorf("sing-box: detour %q: no such outbound", tag)
+	}
+	switch typ, _ := all[j]["type"].(string); {
+	case typ == "direct":
+		return -1, nil
+	case typ == "":
+		return -1, fmt.Errorf("sing-box: detour %q: outbound without type", tag)
+	case singBoxServiceTypes[typ]:
+		return -1, fmt.Errorf("sing-box: detour %q: %s outbound is not a server", tag, typ)
+	}
+	return j, nil
+}
+
+// detourRef — detour на другой узел того же конфига: индекс узла в результате разбора.
+// ID узлам выдаёт AssignIDs уже после разбора, поэтому ссылку заменяет на ID resolveDetourRefs.
+type detourRef int
+
+// resolveDetourRefs заменяет detourRef в outbound узлов на ID узла, на который он указывает.
+func resolveDetourRefs(nodes []store.ServerNode) {
+	for i := range nodes {
+		if ref, ok := nodes[i].Outbound["detour"].(detourRef); ok {
+			nodes[i].Outbound["detour"] = nodes[ref].ID
+		}
+	}
+}
+
+// isSingBoxOutbound — тело — один outbound sing-box (JSON-объект с type), а не целый конфиг.
+func isSingBoxOutbound(content string) bool {
+	if !strings.HasPrefix(content, "{") {
+		return false
+	}
+	var probe struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal([]byte(content), &probe) == nil && probe.Type != ""
+}
+
+// parseSingBoxOutbound импортирует один outbound как узел, tag становится именем. В отличие от целого конфига,
+// строка в detour здесь — ID другого сохранённого сервера (цепочка серверов), поэтому она сохраняется.
+func parseSingBoxOutbound(content string, rep *Report) ([]store.ServerNode, error) {
+	var ob map[string]any
+	if err := json.Unmarshal([]byte(content), &ob); err != nil {
+		return nil, fmt.Errorf("sing-box json: %w", err)
+	}
+	typ, _ := ob["type"].(string)
+	name, _ := ob["tag"].(string)
+	if singBoxServiceTypes[typ] {
+		rep.add(1, name, -1, fmt.Errorf("sing-box: %s outbound is not a server", typ))
+		return nil, nil
+	}
+	delete(ob, "tag")
+	address := singBoxServerAddress(ob)
+	if name == "" {
+		// Как у ссылки без #имени — именем становится адрес.
+		name = address
+	}
+	rep.add(1, name, 0, nil)
+	return []store.ServerNode{{
+		Name:     name,
+		Address:  address,
+		Outbound: ob,
+	}}, nil
+}
+
+// shadowTLSWrappers — shadowtls outbound, на которые ссылается detour других outbound, по tag (без самого tag).
+// Отдельными узлами они не импортируются: это обёртка, а не сервер.
+func shadowTLSWrappers(all []map[string]any) map[string]map[string]any {
+	byTag := make(map[string]map[string]any, len(all))
+	for _, ob := range all {
+		if tag, _ := ob["tag"].(string); tag != "" && ob["type"] == "shadowtls" {
+			byTag[tag] = ob
+		}
+	}
+	wrappers := map[string]map[string]any{}
+	for _, ob := range all {
+		tag, _ := ob["detour"].(string)
+		if wrapper := byTag[tag]; wrapper != nil {
+			copied := make(map[string]any, len(wrapper))
+			for k, v := range wrapper {
+				if k != "tag" {
+					copied[k] = v
+				}
+			}
+			wrappers[tag] = copied
+		}
+	}
+	return wrappers
+}
+
+// singBoxServerAddress — адрес сервера outbound (для wireguard endpoint — адрес первого пира).
+func singBoxServerAddress(ob map[string]any) string {
+	if server, _ := ob["server"].(string); server != "" {
+		return server
+	}
+	if peers, ok := ob["peers"].([]any); ok && len(peers) > 0 {
+		if peer, ok := peers[0].(map[string]any); ok {
+			addr, _ := peer["address"].(string)
+			return addr
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package subscription
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSingBoxJSONDetour(t *testing.T) {
+	body := `{"outbounds": [
+		{"type": "shadowsocks", "tag": "exit", "server": "5.6.7.8", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret", "detour": "hop"},
+		{"type": "shadowsocks", "tag": "hop", "server": "1.2.3.4", "server_port": 8388,
+			"method": "aes-256-gcm", "password": "secret"},
+		{"type": "vless", "tag": "plain", "server": "9.9.9.9", "server_port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "detour": "direct"},
+		{"type": "vless", "tag": "via auto", "server": "8.8.8.8", "server_port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "detour": "auto"},
+		{"type": "vless", "tag": "via missing", "server": "7.7.7.7", "server_port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "detour": "nowhere"},
+		{"type": "vless", "tag": "via skipped", "server": "6.6.6.6", "server_port": 443,
+			"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "detour": "via auto"},
+		{"type": "urltest", "tag": "auto", "outbounds": ["exit", "hop"]},
+		{"type": "direct", "tag": "direct"}
+	]}`
+	nodes, rep, err := ParseContentReport(body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]int{}
+	for i, n := range nodes {
+		byName[n.Name] = i
+	}
+	if len(nodes) != 3 || rep.Accepted != 3 || rep.Rejected != 3 {
+		t.Fatalf("nodes = %d, accepted = %d, rejected = %d, want 3/3/3", len(nodes), rep.Accepted, rep.Rejected)
+	}
+	exit, hop, plain := nodes[byName["exit"]], nodes[byName["hop"]], nodes[byName["plain"]]
+	// Ссылка на другой сервер конфига становится его ID и переживает сохранение в JSON.
+	if got := exit.Outbound["detour"]; got != hop.ID {
+		t.Errorf("exit detour = %#v, want %s", got, hop.ID)
+	}
+	if _, err := json.Marshal(exit); err != nil {
+		t.Errorf("marshal: %v", err)
+	}
+	if _, ok := plain.Outbound["detour"]; ok {
+		t.Errorf("detour to direct was kept: %v", plain.Outbound["detour"])
+	}
+	for _, l := range rep.Lines {
+		switch l.Text {
+		case "via auto", "via missing", "via skipped":
+			if l.Status != LineMalformed || l.Reason == "" || l.NodeID != "" {
+				t.Errorf("%s: status = %s, reason = %q, node = %q; want skipped", l.Text, l.Status, l.Reason, l.NodeID)
+			}
+		}
+	}
+}
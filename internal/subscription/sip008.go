@@ -0,0 +1,74 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// sip008Server — элемент servers в SIP008 online config.
+type sip008Server struct {
+	ID         string `json:"id"`
+	Remarks    string `json:"remarks"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+	Password   string `json:"password"`
+	Method     string `json:"method"`
+	Plugin     string `json:"plugin"`
+	PluginOpts string `json:"plugin_opts"`
+}
+
+// isSIP008JSON — похоже ли тело на SIP008 ({"version":1,"servers":[...]}).
+func isSIP008JSON(content string) bool {
+	if !strings.HasPrefix(content, "{") {
+		return false
+	}
+	var probe struct {
+		Version int             `json:"version"`
+		Servers json.RawMessage `json:"servers"`
+	}
+	if err := json.Unmarshal([]byte(content), &probe); err != nil {
+		return false
+	}
+	return probe.Version == 1 && len(probe.Servers) > 0
+}
+
+// sip008ToURIs превращает SIP008 в SIP002 ss:// ссылки (плагины переносятся в ?plugin=).
+// Номер строки в отчёте — номер элемента servers; неполные элементы отмечаются как malformed.
+func sip008ToURIs(content string, rep *Report) ([]sourceLine, error) {
+	var doc struct {
+		Servers []sip008Server `json:"servers"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("sip008: %w", err)
+	}
+	uris := make([]sourceLine, 0, len(doc.Servers))
+	for i, s := range doc.Servers {
+		if s.Server == "" || s.ServerPort == 0 || s.Method == "" || s.Password == "" {
+			rep.add(i+1, s.Remarks, -1, fmt.Errorf("sip008: missing server/server_port/method/password"))
+			continue
+		}
+		userInfo := base64.RawURLEncoding.EncodeToString([]byte(s.Method + ":" + s.Password))
+		u := "ss://" + userInfo + "@" + net.JoinHostPort(s.Server, strconv.Itoa(s.ServerPort))
+		if s.Plugin != "" {
+			plugin := s.Plugin
+			if s.PluginOpts != "" {
+				plugin += ";" + s.PluginOpts
+			}
+			u += "/?plugin=" + url.QueryEscape(plugin)
+		}
+		name := s.Remarks
+		if name == "" {
+			name = s.ID
+		}
+		if name != "" {
+			u += "#" + url.PathEscape(name)
+		}
+		uris = append(uris, sourceLine{num: i + 1, text: u})
+	}
+	return uris, nil
+}
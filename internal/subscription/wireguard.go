@@ -0,0 +1,326 @@
+package subscription
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// isWireGuardConf — похоже ли тело на wg-quick конфиг ([Interface] + [Peer]).
+func isWireGuardConf(content string) bool {
+	lower := strings.ToLower(content)
+	return strings.Contains(lower, "[interface]") && strings.Contains(lower, "[peer]")
+}
+
+// wireGuardConf — один wg-quick конфиг: [Interface], его [Peer] по порядку и имя из комментария.
+type wireGuardConf struct {
+	iface map[string]string
+	peers []map[string]string
+	name  string
+}
+
+// parseWireGuardConf превращает один или несколько wg-quick конфигов (каждый начинается с [Interface]) в узлы.
+// Конфиг с одним пиром становится wireguard:// ссылкой, которую понимает vpn.outboundFromURI; ссылка описывает
+// только одного пира, поэтому конфиг с несколькими [Peer] сохраняется готовым endpoint со всеми пирами.
+func parseWireGuardConf(content string, rep *Report) ([]store.ServerNode, error) {
+	confs, err := splitWireGuardConfs(content)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]store.ServerNode, 0, len(confs))
+	for i, c := range confs {
+		if len(c.peers) > 1 {
+			ob, err := wireGuardOutbound(c)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := wireGuardEndpoint(c.peers[0]["endpoint"])
+			name := c.name
+			if name == "" {
+				name = host
+			}
+			rep.add(i+1, fmt.Sprintf("[Interface] with %d peers", len(c.peers)), len(out), nil)
+			out = append(out, store.ServerNode{Name: name, Address: host, Outbound: ob})
+			continue
+		}
+		uri, err := wireGuardURI(c.iface, c.peers, c.name)
+		if err != nil {
+			return nil, err
+		}
+		rep.add(i+1, uri, len(out), nil)
+		out = append(out, store.ServerNode{Name: extractNameFromURI(uri), Address: extractHostFromURI(uri), URI: uri})
+	}
+	return out, nil
+}
+
+func splitWireGuardConfs(content string) ([]wireGuardConf, error) {
+	var (
+		confs   []wireGuardConf
+		section string
+		cur     *wireGuardConf
+		name    string
+	)
+	sc := bufio.NewScanner(strings.NewReader(content))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			// Некоторые генераторы пишут имя узла комментарием: "# Name = Germany".
+			comment := strings.TrimSpace(strings.TrimLeft(line, "#;"))
+			if k, v, ok := strings.Cut(comment, "="); ok && strings.EqualFold(strings.TrimSpace(k), "name") {
+				name = strings.TrimSpace(v)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.Trim(line, "[] "))
+			switch section {
+			case "interface":
+				// Имя-комментарий относится к [Interface], который за ним следует, а не к предыдущему конфигу.
+				if cur != nil {
+					confs = append(confs, *cur)
+				}
+				cur = &wireGuardConf{iface: map[string]string{}, name: name}
+				name = ""
+			case "peer":
+				if cur != nil {
+					cur.peers = append(cur.peers, map[string]string{})
+				}
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || cur == nil {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var target map[string]string
+		switch {
+		case section == "interface":
+			target = cur.iface
+		case section == "peer" && len(cur.peers) > 0:
+			target = cur.peers[len(cur.peers)-1]
+		default:
+			continue
+		}
+		// Address и AllowedIPs могут повторяться строками — склеиваем через запятую.
+		if prev, exists := target[key]; exists && prev != "" {
+			value = prev + "," + value
+		}
+		target[key] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		if cur.name == "" {
+			// Имя в конце файла или внутри секций единственного конфига.
+			cur.name = name
+		}
+		confs = append(confs, *cur)
+	}
+	return confs, nil
+}
+
+// wireGuardURI — ссылка на конфиг с одним пиром.
+func wireGuardURI(iface map[string]string, peers []map[string]string, name string) (string, error) {
+	if iface["privatekey"] == "" {
+		return "", fmt.Errorf("wireguard conf: missing PrivateKey")
+	}
+	if iface["address"] == "" {
+		return "", fmt.Errorf("wireguard conf: missing Address")
+	}
+	if len(peers) == 0 {
+		return "", fmt.Errorf("wireguard conf: missing [Peer]")
+	}
+	peer := peers[0]
+	if peer["publickey"] == "" {
+		return "", fmt.Errorf("wireguard conf: missing peer PublicKey")
+	}
+	if peer["endpoint"] == "" {
+		return "", fmt.Errorf("wireguard conf: missing peer Endpoint")
+	}
+
+	q := url.Values{}
+	q.Set("publickey", peer["publickey"])
+	q.Set("address", joinList(iface["address"]))
+	if v := peer["presharedkey"]; v != "" {
+		q.Set("presharedkey", v)
+	}
+	if v := peer["allowedips"]; v != "" {
+		q.Set("allowedips", joinList(v))
+	}
+	if v := peer["persistentkeepalive"]; v != "" && !strings.EqualFold(v, "off") {
+		q.Set("keepalive", v)
+	}
+	if v := iface["mtu"]; v != "" {
+		q.Set("mtu", v)
+	}
+	// Reserved — нестандартный ключ (WARP), встречается и в [Interface], и в [Peer].
+	if v := peer["reserved"]; v != "" {
+		q.Set("reserved", joinList(v))
+	} else if v := iface["reserved"]; v != "" {
+		q.Set("reserved", joinList(v))
+	}
+
+	u := url.URL{
+		Scheme:   "wireguard",
+		User:     url.User(iface["privatekey"]),
+		Host:     peer["endpoint"],
+		RawQuery: q.Encode(),
+		Fragment: name,
+	}
+	return u.String(), nil
+}
+
+// wireGuardOutbound собирает sing-box wireguard endpoint со всеми пирами конфига
+// (те же поля, что vpn строит из wireguard:// ссылки).
+func wireGuardOutbound(c wireGuardConf) (map[string]any, error) {
+	if c.iface["privatekey"] == "" {
+		return nil, fmt.Errorf("wireguard conf: missing PrivateKey")
+	}
+	addresses := WireGuardAddresses(c.iface["address"])
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("wireguard conf: missing Address")
+	}
+
+	peers := make([]any, 0, len(c.peers))
+	for i, p := range c.peers {
+		if p["publickey"] == "" {
+			return nil, fmt.Errorf("wireguard conf: peer %d: missing PublicKey", i+1)
+		}
+		host, port, err := wireGuardEndpoint(p["endpoint"])
+		if err != nil {
+			return nil, fmt.Errorf("wireguard conf: peer %d: %w", i+1, err)
+		}
+		allowed := SplitList(p["allowedips"])
+		if len(allowed) == 0 {
+			allowed = []string{"0.0.0.0/0", "::/0"}
+		}
+		peer := map[string]any{
+			"address":     host,
+			"port":        port,
+			"public_key":  p["publickey"],
+			"allowed_ips": allowed,
+		}
+		if v := p["presharedkey"]; v != "" {
+			peer["pre_shared_key"] = v
+		}
+		if v := p["persistentkeepalive"]; v != "" && !strings.EqualFold(v, "off") {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("wireguard conf: peer %d: invalid PersistentKeepalive: %s", i+1, v)
+			}
+			if n > 0 {
+				peer["persistent_keepalive_interval"] = n
+			}
+		}
+		reserved := p["reserved"]
+		if reserved == "" {
+			reserved = c.iface["reserved"]
+		}
+		if reserved != "" {
+			r, err := WireGuardReserved(reserved)
+			if err != nil {
+				return nil, fmt.Errorf("wireguard conf: peer %d: %w", i+1, err)
+			}
+			peer["reserved"] = r
+		}
+		peers = append(peers, peer)
+	}
+
+	out := map[string]any{
+		"type":        "wireguard",
+		"address":     addresses,
+		"private_key": c.iface["privatekey"],
+		"peers":       peers,
+	}
+	if v := c.iface["mtu"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("wireguard conf: invalid MTU: %s", v)
+		}
+		out["mtu"] = n
+	}
+	return out, nil
+}
+
+// wireGuardEndpoint разбирает Endpoint пира: host:port, [v6]:port; без порта — 51820.
+func wireGuardEndpoint(endpoint string) (string, int, error) {
+	if endpoint == "" {
+		return "", 0, fmt.Errorf("missing Endpoint")
+	}
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return strings.Trim(endpoint, "[]"), 51820, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid Endpoint port: %s", endpoint)
+	}
+	return host, port, nil
+}
+
+// WireGuardReserved понимает "1,2,3" и base64 из трёх байт (client_id в конфигах WARP).
+// Общий разбор для wg-quick конфигов и wireguard:// ссылок (vpn).
+func WireGuardReserved(s string) ([]int, error) {
+	var raw []byte
+	if strings.Contains(s, ",") {
+		for _, p := range SplitList(s) {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n > 255 {
+				return nil, fmt.Errorf("invalid reserved byte: %s", p)
+			}
+			raw = append(raw, byte(n))
+		}
+	} else {
+		decoded, err := decodeBase64Any(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved: %s", s)
+		}
+		raw = []byte(decoded)
+	}
+	if len(raw) != 3 {
+		return nil, fmt.Errorf("reserved must have 3 bytes: %s", s)
+	}
+	return []int{int(raw[0]), int(raw[1]), int(raw[2])}, nil
+}
+
+// WireGuardAddresses — адреса интерфейса из списка через запятую; адрес без префикса — одиночный хост (/32, /128).
+func WireGuardAddresses(s string) []string {
+	addresses := SplitList(s)
+	for i, a := range addresses {
+		if !strings.Contains(a, "/") {
+			if strings.Contains(a, ":") {
+				addresses[i] = a + "/128"
+			} else {
+				addresses[i] = a + "/32"
+			}
+		}
+	}
+	return addresses
+}
+
+// SplitList делит строку по запятым, отбрасывая пустые элементы и пробелы.
+func SplitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// joinList нормализует список через запятую: "a, b,c" -> "a,b,c".
+func joinList(s string) string {
+	return strings.Join(SplitList(s), ",")
+}
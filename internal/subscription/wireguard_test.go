@@ -0,0 +1,151 @@
+package subscription
+
+import (
+	"reflect"
+	"testing"
+)
+
+const wgInterface = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Address = 10.0.0.2/32, fd00::2
+MTU = 1280
+`
+
+func TestParseWireGuardConfSinglePeer(t *testing.T) {
+	body := "# Name = Germany\n" + wgInterface + `
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = de.example.com:51820
+AllowedIPs = 0.0.0.0/0, ::/0
+PersistentKeepalive = 25
+`
+	nodes, rep, err := ParseContentReport(body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Format != FormatWireGuard || len(nodes) != 1 {
+		t.Fatalf("format = %s, nodes = %d", rep.Format, len(nodes))
+	}
+	n := nodes[0]
+	if n.Outbound != nil || n.Name != "Germany" || n.Address != "de.example.com" {
+		t.Errorf("node = %+v, want a wireguard:// link named Germany", n)
+	}
+	const want = "wireguard://yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=@de.example.com:51820" +
+		"?address=10.0.0.2%2F32%2Cfd00%3A%3A2&allowedips=0.0.0.0%2F0%2C%3A%3A%2F0&keepalive=25&mtu=1280" +
+		"&publickey=xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg%3D#Germany"
+	if n.URI != want {
+		t.Errorf("uri = %s\nwant  %s", n.URI, want)
+	}
+}
+
+func TestParseWireGuardConfMultiplePeers(t *testing.T) {
+	body := wgInterface + `
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = 1.2.3.4:51820
+AllowedIPs = 10.0.0.0/24
+Reserved = 1, 2, 3
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+PresharedKey = FpCyhws9cxwWoV4xELtfJvjJN+zQVRPISllRWgeopVE=
+Endpoint = [2001:db8::1]:443
+AllowedIPs = 10.0.1.0/24
+AllowedIPs = fd00:1::/64
+Reserved = AQID
+`
+	nodes, rep, err := ParseContentReport(body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || rep.Accepted != 1 {
+		t.Fatalf("nodes = %d, accepted = %d, want one node", len(nodes), rep.Accepted)
+	}
+	n := nodes[0]
+	if n.URI != "" || n.Name != "1.2.3.4" || n.Address != "1.2.3.4" {
+		t.Errorf("node = %+v", n)
+	}
+	want := map[string]any{
+		"type":        "wireguard",
+		"address":     []string{"10.0.0.2/32", "fd00::2/128"},
+		"private_key": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+		"mtu":         1280,
+		"peers": []any{
+			map[string]any{
+				"address": "1.2.3.4", "port": 51820,
+				"public_key":  "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=",
+				"allowed_ips": []string{"10.0.0.0/24"},
+				"reserved":    []int{1, 2, 3},
+			},
+			map[string]any{
+				"address": "2001:db8::1", "port": 443,
+				"public_key":     "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=",
+				"pre_shared_key": "FpCyhws9cxwWoV4xELtfJvjJN+zQVRPISllRWgeopVE=",
+				"allowed_ips":    []string{"10.0.1.0/24", "fd00:1::/64"},
+				"reserved":       []int{1, 2, 3},
+			},
+		},
+	}
+	if !reflect.DeepEqual(n.Outbound, want) {
+		t.Errorf("outbound\n got: %#v\nwant: %#v", n.Outbound, want)
+	}
+}
+
+func TestParseWireGuardConfPeerErrors(t *testing.T) {
+	for name, peer := range map[string]string{
+		"missing public key": "[Peer]\nEndpoint = 1.2.3.4:51820\n",
+		"missing endpoint":   "[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\n",
+		"bad reserved":       "[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = 1.2.3.4:51820\nReserved = 1,2\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := wgInterface + "[Peer]\nPublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=\nEndpoint = 5.6.7.8:51820\n" + peer
+			if _, _, err := ParseContentReport(body, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// Имя-комментарий перед [Interface] относится к следующему конфигу, а не к предыдущему.
+func TestParseWireGuardConfConcatenated(t *testing.T) {
+	peer := func(host string) string {
+		return "[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = " + host + ":51820\n"
+	}
+	body := "# Name = Germany\n" + wgInterface + peer("de.example.com") +
+		"\n# Name = France\n" + wgInterface + peer("fr.example.com") +
+		"\n" + wgInterface + peer("nl.example.com")
+	nodes, rep, err := ParseContentReport(body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 || rep.Accepted != 3 {
+		t.Fatalf("nodes = %d, accepted = %d, want 3", len(nodes), rep.Accepted)
+	}
+	for i, want := range []struct{ name, address string }{
+		{"Germany", "de.example.com"},
+		{"France", "fr.example.com"},
+		{"nl.example.com:51820", "nl.example.com"},
+	} {
+		if nodes[i].Name != want.name || nodes[i].Address != want.address {
+			t.Errorf("node %d = %s (%s), want %s (%s)", i, nodes[i].Name, nodes[i].Address, want.name, want.address)
+		}
+	}
+}
+
+func TestWireGuardReserved(t *testing.T) {
+	for in, want := range map[string][]int{"1, 2, 3": {1, 2, 3}, "AQID": {1, 2, 3}, "AQI": nil, "1,2": nil, "1,2,300": nil} {
+		got, err := WireGuardReserved(in)
+		if want == nil {
+			if err == nil {
+				t.Errorf("WireGuardReserved(%q) = %v, want error", in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("WireGuardReserved(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if got := WireGuardAddresses("10.0.0.2, fd00::2 ,10.1.0.0/16"); !reflect.DeepEqual(got, []string{"10.0.0.2/32", "fd00::2/128", "10.1.0.0/16"}) {
+		t.Errorf("WireGuardAddresses = %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package vpn
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+const (
+	// defaultRefreshInterval — если ни подписка, ни настройки, ни провайдер не задали интервал.
+	defaultRefreshInterval = 12 * time.Hour
+	// autoRefreshTick — как часто планировщик проверяет, не пора ли обновить подписки.
+	autoRefreshTick = time.Minute
+	// minRefreshMinutes — самый частый интервал, который можно задать подписке или в настройках.
+	minRefreshMinutes = 5
+	// Backoff после ошибки: 1m, 2m, 4m… но не дольше обычного интервала и не дольше maxRefreshBackoff.
+	baseRefreshBackoff = time.Minute
+	maxRefreshBackoff  = 6 * time.Hour
+)
+
+// Clock — источник времени для планировщика; в тестах подменяется управляемыми часами.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock подменяет часы движка (метки last_success/last_error и расписание автообновления).
+func (e *Engine) SetClock(c Clock) {
+	e.clock = c
+}
+
+// SetBroadcast задаёт, куда отправлять события для UI (обычно srv.Broadcast).
+func (e *Engine) SetBroadcast(fn func(event map[string]interface{})) {
+	e.broadcast = fn
+}
+
+func (e *Engine) notify(event map[string]interface{}) {
+	if e.broadcast != nil {
+		e.broadcast(event)
+	}
+}
+
+// StartAutoRefresh запускает фоновое обновление подписок; останавливается при отмене ctx.
+func (e *Engine) StartAutoRefresh(ctx context.Context) {
+	go func() {
+		for {
+			e.refreshDueSubscriptions()
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.clock.After(autoRefreshTick):
+			}
+		}
+	}()
+}
+
+// refreshDueSubscriptions обновляет подписки, у которых подошло время, и возвращает их число.
+// Если что-то обновлялось (успешно или нет), UI получает событие subscriptions_updated.
+func (e *Engine) refreshDueSubscriptions() int {
+	subs, err := e.store.GetSubscriptions()
+	if err != nil {
+		return 0
+	}
+	settings, _ := e.store.GetSettings()
+	now := e.clock.Now()
+	count := 0
+	for _, sub := range subs {
+		if sub.URL == "" || !e.refreshDue(sub, settings, now) {
+			continue
+		}
+		if _, err := e.RefreshSubscription(sub.ID); err != nil {
+			log.Printf("auto-refresh subscription %s: %v", sub.ID, err)
+		}
+		count++
+	}
+	if count > 0 {
+		e.notify(map[string]interface{}{"type": "subscriptions_updated"})
+	}
+	return count
+}
+
+func (e *Engine) refreshDue(sub store.Subscription, settings store.Settings, now time.Time) bool {
+	interval := refreshInterval(sub, settings)
+	if interval <= 0 {
+		return false
+	}
+	if sub.NextRefreshAt > 0 {
+		return now.Unix() >= sub.NextRefreshAt
+	}
+	// Подписки, обновлённые до появления планировщика, ещё без расписания.
+	return now.Sub(time.Unix(sub.LastSuccess, 0)) >= interval
+}
+
+// refreshInterval: интервал подписки → общий из настроек → profile-update-interval провайдера → по умолчанию.
+// Отрицательное значение в подписке или настройках выключает автообновление.
+func refreshInterval(sub store.Subscription, settings store.Settings) time.Duration {
+	switch {
+	case sub.RefreshMinutes != 0:
+		return time.Duration(sub.RefreshMinutes) * time.Minute
+	case settings.SubscriptionRefreshMinutes != nil && *settings.SubscriptionRefreshMinutes != 0:
+		return time.Duration(*settings.SubscriptionRefreshMinutes) * time.Minute
+	case sub.UpdateInterval > 0:
+		return time.Duration(sub.UpdateInterval) * time.Hour
+	}
+	return defaultRefreshInterval
+}
+
+// validateRefreshMinutes проверяет интервал из запроса: 0 — не задан, отрицательный выключает автообновление,
+// положительный — не чаще minRefreshMinutes.
+func validateRefreshMinutes(field string, minutes int) error {
+	if minutes > 0 && minutes < minRefreshMinutes {
+		return fmt.Errorf("%w: %s must be at least %d (or negative to disable auto-refresh)", ErrInvalidInput, field, minRefreshMinutes)
+	}
+	return nil
+}
+
+// refreshBackoff — пауза перед повтором после failCount ошибок подряд, с разбросом ±20%,
+// чтобы подписки одного провайдера не стучались одновременно.
+func refreshBackoff(failCount int, interval time.Duration, jitter float64) time.Duration {
+	d := baseRefreshBackoff
+	for i := 1; i < failCount && d < maxRefreshBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRefreshBackoff {
+		d = maxRefreshBackoff
+	}
+	if interval > 0 && d > interval {
+		d = interval
+	}
+	return time.Duration(float64(d) * (0.8 + 0.4*jitter))
+}
+
+// recordRefresh сохраняет исход обновления и планирует следующее.
+// Вызывается внутри store.UpdateSubscription, поэтому настройки передаются снаружи (store уже заблокирован).
+func recordRefresh(s *store.Subscription, settings store.Settings, now time.Time, refreshErr error) {
+	interval := refreshInterval(*s, settings)
+	if refreshErr == nil {
+		s.LastSuccess = now.Unix()
+		s.UpdatedAt = now.Unix()
+		s.LastError = ""
+		s.FailCount = 0
+		s.NextRefreshAt = 0
+		if interval > 0 {
+			s.NextRefreshAt = now.Add(interval).Unix()
+		}
+		return
+	}
+	s.LastError = refreshErr.Error()
+	s.LastErrorAt = now.Unix()
+	s.FailCount++
+	s.NextRefreshAt = now.Add(refreshBackoff(s.FailCount, interval, rand.Float64())).Unix()
+}
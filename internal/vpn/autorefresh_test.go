@@ -0,0 +1,348 @@
+package vpn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// fakeClock — управляемые часы. Паузы короче тика планировщика (повторы загрузки) проходят сразу и сдвигают время;
+// тик планировщика ждёт, пока тест не получит его канал из ticks и не отпустит.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	ticks  chan chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), ticks: make(chan chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if d >= autoRefreshTick {
+		c.ticks <- ch
+		return ch
+	}
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch <- c.now
+	c.mu.Unlock()
+	return ch
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) takeSleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.sleeps
+	c.sleeps = nil
+	return out
+}
+
+// subServer — провайдер подписки: отдаёт body с ETag, на совпадающий If-None-Match отвечает 304,
+// при status != 0 — этим кодом.
+type subServer struct {
+	mu             sync.Mutex
+	body           string
+	etag           string
+	updateInterval int
+	status         int
+	requests       int
+	ifNoneMatch    []string
+}
+
+func (s *subServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if s.updateInterval > 0 {
+		w.Header().Set("Profile-Update-Interval", strconv.Itoa(s.updateInterval))
+	}
+	w.Write([]byte(s.body))
+}
+
+func (s *subServer) set(fn func(s *subServer)) {
+	s.mu.Lock()
+	fn(s)
+	s.mu.Unlock()
+}
+
+func (s *subServer) stats() (int, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, append([]string(nil), s.ifNoneMatch...)
+}
+
+const testSubscriptionBody = "ss://YWVzLTI1Ni1nY206c2VjcmV0@1.2.3.4:8388#one\n" +
+	"ss://YWVzLTI1Ni1nY206c2VjcmV0@5.6.7.8:8388#two\n"
+
+func newSchedulerEngine(t *testing.T, srv *subServer) (*Engine, *fakeClock, string) {
+	t.Helper()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	clock := newFakeClock()
+	e.SetClock(clock)
+	sub, err := e.AddSubscription("test", ts.URL+"/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, clock, sub.ID
+}
+
+func mustSubscription(t *testing.T, e *Engine, id string) *store.Subscription {
+	t.Helper()
+	sub, err := e.store.GetSubscription(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func TestAutoRefreshInterval(t *testing.T) {
+	srv := &subServer{body: testSubscriptionBody, updateInterval: 6}
+	e, clock, id := newSchedulerEngine(t, srv)
+
+	// Новая подписка без расписания обновляется сразу.
+	if n := e.refreshDueSubscriptions(); n != 1 {
+		t.Fatalf("first pass refreshed %d subscriptions, want 1", n)
+	}
+	sub := mustSubscription(t, e, id)
+	if len(sub.Servers) != 2 {
+		t.Fatalf("servers = %d, want 2", len(sub.Servers))
+	}
+	start := clock.Now()
+	if sub.LastSuccess != start.Unix() || sub.LastError != "" {
+		t.Errorf("last_success = %d, last_error = %q", sub.LastSuccess, sub.LastError)
+	}
+	// Интервал из profile-update-interval провайдера (часы).
+	if want := start.Add(6 * time.Hour).Unix(); sub.NextRefreshAt != want {
+		t.Errorf("next_refresh_at = %d, want %d", sub.NextRefreshAt, want)
+	}
+
+	clock.advance(6*time.Hour - time.Minute)
+	if n := e.refreshDueSubscriptions(); n != 0 {
+		t.Errorf("refreshed %d subscriptions before the interval", n)
+	}
+	clock.advance(time.Minute)
+	if n := e.refreshDueSubscriptions(); n != 1 {
+		t.Errorf("refreshed %d subscriptions after the interval, want 1", n)
+	}
+
+	// Интервал из настроек важнее, чем у провайдера.
+	minutes := 30
+	if _, err := e.store.UpdateSettings(store.Settings{SubscriptionRefreshMinutes: &minutes}); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(6 * time.Hour)
+	e.refreshDueSubscriptions()
+	if sub, want := mustSubscription(t, e, id), clock.Now().Add(30*time.Minute).Unix(); sub.NextRefreshAt != want {
+		t.Errorf("next_refresh_at = %d, want %d (settings interval)", sub.NextRefreshAt, want)
+	}
+	if requests, _ := srv.stats(); requests != 3 {
+		t.Errorf("provider got %d requests, want 3", requests)
+	}
+}
+
+func TestAutoRefreshBackoff(t *testing.T) {
+	srv := &subServer{body: testSubscriptionBody}
+	e, clock, id := newSchedulerEngine(t, srv)
+	e.refreshDueSubscriptions()
+	clock.takeSleeps()
+
+	srv.set(func(s *subServer) { s.status = http.StatusServiceUnavailable })
+	for failures, base := 1, time.Minute; failures <= 3; failures, base = failures+1, base*2 {
+		clock.advance(24 * time.Hour)
+		if n := e.refreshDueSubscriptions(); n != 1 {
+			t.Fatalf("failure %d: refreshed %d subscriptions, want 1", failures, n)
+		}
+		// Повторы внутри одной загрузки (5xx) идут по часам движка: 1s, затем 2s.
+		if sleeps := clock.takeSleeps(); len(sleeps) != 2 || sleeps[0] != time.Second || sleeps[1] != 2*time.Second {
+			t.Errorf("failure %d: retry delays = %v, want [1s 2s]", failures, sleeps)
+		}
+		sub := mustSubscription(t, e, id)
+		now := clock.Now()
+		if sub.FailCount != failures || sub.LastErrorAt != now.Unix() || sub.LastError == "" {
+			t.Errorf("failure %d: fail_count = %d, last_error_at = %d, last_error = %q",
+				failures, sub.FailCount, sub.LastErrorAt, sub.LastError)
+		}
+		// Пауза base ±20%.
+		wait := time.Unix(sub.NextRefreshAt, 0).Sub(now)
+		if lo, hi := base*8/10-time.Second, base*12/10+time.Second; wait < lo || wait > hi {
+			t.Errorf("failure %d: next refresh in %v, want %v..%v", failures, wait, lo, hi)
+		}
+		if len(sub.Servers) != 2 {
+			t.Errorf("failure %d: servers were dropped", failures)
+		}
+	}
+
+	srv.set(func(s *subServer) { s.status = 0 })
+	clock.advance(24 * time.Hour)
+	e.refreshDueSubscriptions()
+	if sub := mustSubscription(t, e, id); sub.FailCount != 0 || sub.LastError != "" || sub.LastSuccess != clock.Now().Unix() {
+		t.Errorf("after recovery: fail_count = %d, last_error = %q", sub.FailCount, sub.LastError)
+	}
+}
+
+func TestAutoRefreshETag(t *testing.T) {
+	srv := &subServer{body: testSubscriptionBody, etag: `"v1"`}
+	e, clock, id := newSchedulerEngine(t, srv)
+	e.refreshDueSubscriptions()
+	if sub := mustSubscription(t, e, id); sub.ETag != `"v1"` {
+		t.Fatalf("etag = %q, want \"v1\"", sub.ETag)
+	}
+
+	// 304: список прежний, успешная проверка отмечена.
+	srv.set(func(s *subServer) { s.body = "" })
+	clock.advance(24 * time.Hour)
+	if n := e.refreshDueSubscriptions(); n != 1 {
+		t.Fatalf("refreshed %d subscriptions, want 1", n)
+	}
+	sub := mustSubscription(t, e, id)
+	if len(sub.Servers) != 2 || sub.LastSuccess != clock.Now().Unix() {
+		t.Errorf("after 304: servers = %d, last_success = %d", len(sub.Servers), sub.LastSuccess)
+	}
+
+	// Новая версия у провайдера — загружается полностью.
+	srv.set(func(s *subServer) {
+		s.etag = `"v2"`
+		s.body = "ss://YWVzLTI1Ni1nY206c2VjcmV0@9.9.9.9:8388#three\n"
+	})
+	clock.advance(24 * time.Hour)
+	e.refreshDueSubscriptions()
+	sub = mustSubscription(t, e, id)
+	if len(sub.Servers) != 1 || sub.ETag != `"v2"` {
+		t.Errorf("after change: servers = %d, etag = %q", len(sub.Servers), sub.ETag)
+	}
+
+	_, sent := srv.stats()
+	if want := []string{"", `"v1"`, `"v1"`}; len(sent) != 3 || sent[0] != want[0] || sent[1] != want[1] || sent[2] != want[2] {
+		t.Errorf("If-None-Match sent = %q, want %q", sent, want)
+	}
+}
+
+func TestStartAutoRefresh(t *testing.T) {
+	srv := &subServer{body: testSubscriptionBody}
+	e, clock, id := newSchedulerEngine(t, srv)
+	events := make(chan string, 4)
+	e.SetBroadcast(func(event map[string]interface{}) {
+		events <- event["type"].(string)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.StartAutoRefresh(ctx)
+
+	// Первый проход — сразу при запуске.
+	tick := <-clock.ticks
+	if ev := <-events; ev != "subscriptions_updated" {
+		t.Fatalf("event = %q", ev)
+	}
+	if requests, _ := srv.stats(); requests != 1 {
+		t.Fatalf("provider got %d requests, want 1", requests)
+	}
+
+	// Тик до истечения интервала ничего не обновляет.
+	clock.advance(time.Hour)
+	tick <- clock.Now()
+	tick = <-clock.ticks
+	if requests, _ := srv.stats(); requests != 1 {
+		t.Errorf("provider got %d requests before the interval, want 1", requests)
+	}
+
+	clock.advance(defaultRefreshInterval)
+	tick <- clock.Now()
+	<-clock.ticks
+	if ev := <-events; ev != "subscriptions_updated" {
+		t.Fatalf("event = %q", ev)
+	}
+	if sub := mustSubscription(t, e, id); sub.LastSuccess != clock.Now().Unix() {
+		t.Errorf("last_success = %d, want %d", sub.LastSuccess, clock.Now().Unix())
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %q", ev)
+	default:
+	}
+}
+
+func TestSettingsRefreshInterval(t *testing.T) {
+	srv := &subServer{body: testSubscriptionBody, updateInterval: 6}
+	e, clock, id := newSchedulerEngine(t, srv)
+	e.refreshDueSubscriptions()
+
+	one := 1
+	if _, err := e.UpdateSettings(store.Settings{SubscriptionRefreshMinutes: &one}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("UpdateSettings(1 minute): %v, want ErrInvalidInput", err)
+	}
+
+	// Новый общий интервал применяется к подписке без своего интервала сразу, а не через 6 ч.
+	thirty := 30
+	if _, err := e.UpdateSettings(store.Settings{SubscriptionRefreshMinutes: &thirty}); err != nil {
+		t.Fatal(err)
+	}
+	if sub := mustSubscription(t, e, id); sub.NextRefreshAt != 0 {
+		t.Fatalf("next_refresh_at = %d, want rescheduled", sub.NextRefreshAt)
+	}
+	clock.advance(30 * time.Minute)
+	if n := e.refreshDueSubscriptions(); n != 1 {
+		t.Fatalf("refreshed %d subscriptions after the settings interval, want 1", n)
+	}
+
+	// 0 снимает общий интервал: снова действует profile-update-interval провайдера.
+	zero := 0
+	settings, err := e.UpdateSettings(store.Settings{SubscriptionRefreshMinutes: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SubscriptionRefreshMinutes != nil {
+		t.Fatalf("subscription_refresh_minutes = %d, want cleared", *settings.SubscriptionRefreshMinutes)
+	}
+	clock.advance(time.Hour)
+	if n := e.refreshDueSubscriptions(); n != 0 {
+		t.Errorf("refreshed %d subscriptions with the provider interval pending", n)
+	}
+	clock.advance(5 * time.Hour)
+	if n := e.refreshDueSubscriptions(); n != 1 {
+		t.Errorf("refreshed %d subscriptions after the provider interval, want 1", n)
+	}
+	if sub, want := mustSubscription(t, e, id), clock.Now().Add(6*time.Hour).Unix(); sub.NextRefreshAt != want {
+		t.Errorf("next_refresh_at = %d, want %d (provider interval)", sub.NextRefreshAt, want)
+	}
+}
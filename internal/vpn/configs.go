@@ -0,0 +1,106 @@
+package vpn
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// ConfigRequest — тело POST/PUT /api/configs: вставленный текст или содержимое файла.
+type ConfigRequest struct {
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	SourceURL string `json:"source_url,omitempty"`
+}
+
+// AddConfig сохраняет локальный конфиг (ссылки, base64, Clash YAML, sing-box JSON) как подписку без URL.
+// Серверы разбираются теми же парсерами, что и у подписок; конфиг без серверов не сохраняется.
+func (e *Engine) AddConfig(req ConfigRequest) (*store.Subscription, error) {
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("content required")
+	}
+	if _, err := subscription.ParseContent(req.Content); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Imported config"
+	}
+	sub, err := e.store.AddSubscription(name, "")
+	if err != nil {
+		return nil, err
+	}
+	err = e.store.UpdateSubscription(sub.ID, func(s *store.Subscription) {
+		s.Content = req.Content
+		s.SourceURL = req.SourceURL
+	})
+	if err == nil {
+		_, err = e.RefreshSubscription(sub.ID)
+	}
+	if err != nil {
+		e.setParsed(sub.ID, nil)
+		_ = e.store.DeleteSubscription(sub.ID)
+		return nil, err
+	}
+	return e.store.GetSubscription(sub.ID)
+}
+
+// UpdateConfig меняет имя и/или содержимое локального конфига; при новом содержимом серверы разбираются заново.
+func (e *Engine) UpdateConfig(id string, req ConfigRequest) (*store.Subscription, *subscription.Diff, error) {
+	sub, err := e.getConfig(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Content != "" {
+		if _, err := subscription.ParseContent(req.Content); err != nil {
+			return nil, nil, err
+		}
+	}
+	prevContent := sub.Content
+	err = e.store.UpdateSubscription(id, func(s *store.Subscription) {
+		if name := strings.TrimSpace(req.Name); name != "" {
+			s.Name = name
+		}
+		if req.Content != "" {
+			s.Content = req.Content
+		}
+		if req.SourceURL != "" {
+			s.SourceURL = req.SourceURL
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var diff *subscription.Diff
+	if req.Content != "" && req.Content != prevContent {
+		if diff, err = e.RefreshSubscription(id); err != nil {
+			// Не оставляем конфиг с содержимым, из которого не получилось ни одного сервера.
+			_ = e.store.UpdateSubscription(id, func(s *store.Subscription) { s.Content = prevContent })
+			return nil, nil, err
+		}
+	}
+	updated, err := e.store.GetSubscription(id)
+	return updated, diff, err
+}
+
+// DeleteConfig удаляет локальный конфиг.
+func (e *Engine) DeleteConfig(id string) error {
+	if _, err := e.getConfig(id); err != nil {
+		return err
+	}
+	return e.DeleteSubscription(id)
+}
+
+// getConfig возвращает подписку id, если это локальный конфиг (без URL).
+func (e *Engine) getConfig(id string) (*store.Subscription, error) {
+	sub, err := e.store.GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.URL != "" {
+		return nil, fmt.Errorf("%w: %s is a remote subscription, not a local config", ErrInvalidInput, id)
+	}
+	return sub, nil
+}
@@ -0,0 +1,71 @@
+package vpn
+
+import (
+	"context"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GalitskyKK/nekkus-net/internal/geoip"
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+const (
+	// geoipResolveTimeout — сколько ждать DNS одного сервера при поиске страны по IP.
+	geoipResolveTimeout = 3 * time.Second
+	// geoipWorkers — сколько серверов резолвим одновременно.
+	geoipWorkers = 8
+)
+
+// fillCountriesFromGeoIP ищет страну по IP для узлов, у которых она не определилась по имени.
+// Работает, только если в каталоге данных лежит база GeoIP (см. geoip.FileNames).
+func (e *Engine) fillCountriesFromGeoIP(servers []store.ServerNode) {
+	var missing []int
+	for i := range servers {
+		if servers[i].Country == "" && servers[i].Address != "" {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	db, err := geoip.Open(e.store.DataDir())
+	if err != nil {
+		log.Printf("geoip: %v", err)
+		return
+	}
+	if db == nil {
+		return
+	}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, geoipWorkers)
+	for _, i := range missing {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n *store.ServerNode) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			n.Country = db.Country(resolveServerIP(n.Address))
+		}(&servers[i])
+	}
+	wg.Wait()
+}
+
+// resolveServerIP — IP сервера (адрес как есть или первый ответ DNS); nil при ошибке.
+func resolveServerIP(host string) net.IP {
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), geoipResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	return addrs[0].IP
+}
@@ -3,10 +3,13 @@ package vpn
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -43,15 +46,28 @@ type TrafficStats struct {
 
 const maxLogLines = 500
 
+// proxyPort — порт mixed inbound sing-box на 127.0.0.1 (системный прокси и загрузка подписок через туннель).
+const proxyPort = 7890
+
 type Engine struct {
 	store         *store.Store
 	status        Status
 	statusMu      sync.RWMutex
+	// currentNode — сервер, к которому подключены; читается и фоновым автообновлением подписок. Защищено statusMu.
 	currentNode   *store.ServerNode
+	// currentRemoved — обновление подписки удалило текущий сервер (или сменило его адрес/ключи);
+	// туннель ещё работает по старым данным, UI должен предупредить. Защищено statusMu.
+	currentRemoved bool
 	process       *exec.Cmd
 	lastConfigPath string
 	logBuf        []string
 	logMu         sync.RWMutex
+	clock         Clock
+	// parsed — результат разбора последнего загруженного тела каждой подписки (только в памяти):
+	// отчёт о разборе и список серверов до фильтров подписки (для предпросмотра правил).
+	parsedMu sync.Mutex
+	parsed   map[string]*parsedSubscription
+	broadcast     func(event map[string]interface{})
 }
 
 // logWriter собирает stderr процесса в строки и пишет в e.logBuf.
@@ -84,10 +100,97 @@ func (w *logWriter) Write(p []byte) (n int, err error) {
 }
 
 func NewEngine(st *store.Store) *Engine {
-	return &Engine{
+	e := &Engine{
 		store:  st,
 		status: Disconnected,
+		clock:  realClock{},
+	}
+	if err := e.migrateServers(); err != nil {
+		log.Printf("migrate servers: %v", err)
+	}
+	return e
+}
+
+// migrateServers переводит сохранённые узлы со старых ID (имя-хост) на отпечатки,
+// обновляет ссылки на них в detour других серверов и в настройках (последний и выбранный по умолчанию сервер)
+// и определяет страну по имени у узлов, сохранённых до появления этого поля.
+func (e *Engine) migrateServers() error {
+	subs, err := e.store.GetSubscriptions()
+	if err != nil {
+		return err
+	}
+	renamed := make(map[string]string)
+	migrated := make([][]store.ServerNode, len(subs))
+	changed := make([]bool, len(subs))
+	for i, sub := range subs {
+		servers := make([]store.ServerNode, len(sub.Servers))
+		copy(servers, sub.Servers)
+		servers = subscription.DetectCountries(subscription.AssignIDs(servers))
+		for j := range servers {
+			if servers[j].ID != sub.Servers[j].ID {
+				renamed[sub.Servers[j].ID] = servers[j].ID
+			}
+			if servers[j].ID != sub.Servers[j].ID || servers[j].Name != sub.Servers[j].Name ||
+				servers[j].Country != sub.Servers[j].Country {
+				changed[i] = true
+			}
+		}
+		migrated[i] = servers
+	}
+	for i, sub := range subs {
+		if remapDetours(migrated[i], renamed) {
+			changed[i] = true
+		}
+		if changed[i] {
+			if err := e.store.UpdateSubscriptionServers(sub.ID, migrated[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if len(renamed) == 0 {
+		return nil
+	}
+	manual, err := e.store.GetManualServers()
+	if err != nil {
+		return err
+	}
+	for i := range manual {
+		if remapDetours(manual[i:i+1], renamed) {
+			if err := e.store.UpdateServer(manual[i]); err != nil {
+				return err
+			}
+		}
+	}
+	settings, _ := e.store.GetSettings()
+	var patch store.Settings
+	if id, ok := renamed[settings.LastConnectedServerID]; ok {
+		patch.LastConnectedServerID = id
+	}
+	if id, ok := renamed[settings.DefaultServer]; ok {
+		patch.DefaultServer = id
+	}
+	if patch == (store.Settings{}) {
+		return nil
+	}
+	_, err = e.store.UpdateSettings(patch)
+	return err
+}
+
+// remapDetours переводит detour-ссылки узлов на новые ID (renamed: старый ID → новый).
+// Outbound копируется, а не меняется на месте: исходная карта принадлежит снимку store.
+func remapDetours(servers []store.ServerNode, renamed map[string]string) bool {
+	changed := false
+	for i := range servers {
+		detour, _ := servers[i].Outbound["detour"].(string)
+		id, ok := renamed[detour]
+		if !ok {
+			continue
+		}
+		servers[i].Outbound = maps.Clone(servers[i].Outbound)
+		servers[i].Outbound["detour"] = id
+		changed = true
 	}
+	return changed
 }
 
 // GetLogs возвращает последние строки вывода sing-box (stderr). Пустой слайс, если процесс не запускался или логи не собирались.
@@ -115,15 +218,83 @@ func (e *Engine) setStatus(s Status) {
 }
 
 func (e *Engine) GetCurrentServer() *store.ServerNode {
+	e.statusMu.RLock()
+	defer e.statusMu.RUnlock()
 	return e.currentNode
 }
 
+func (e *Engine) setCurrentServer(n *store.ServerNode) {
+	e.statusMu.Lock()
+	e.currentNode = n
+	e.statusMu.Unlock()
+}
+
+// CurrentServerRemoved — текущий сервер пропал из подписки после обновления.
+func (e *Engine) CurrentServerRemoved() bool {
+	e.statusMu.RLock()
+	defer e.statusMu.RUnlock()
+	return e.currentRemoved
+}
+
+func (e *Engine) setCurrentRemoved(v bool) {
+	e.statusMu.Lock()
+	e.currentRemoved = v
+	e.statusMu.Unlock()
+}
+
 func (e *Engine) GetSettings() (store.Settings, error) {
 	return e.store.GetSettings()
 }
 
 func (e *Engine) UpdateSettings(patch store.Settings) (store.Settings, error) {
-	return e.store.UpdateSettings(patch)
+	patch.UTLSFingerprint = strings.ToLower(strings.TrimSpace(patch.UTLSFingerprint))
+	if patch.UTLSFingerprint != "" && !ValidUTLSFingerprint(patch.UTLSFingerprint) {
+		return store.Settings{}, fmt.Errorf("%w: unsupported utls fingerprint: %s", ErrInvalidInput, patch.UTLSFingerprint)
+	}
+	if patch.SubscriptionRefreshMinutes == nil {
+		return e.store.UpdateSettings(patch)
+	}
+	if err := validateRefreshMinutes("subscription_refresh_minutes", *patch.SubscriptionRefreshMinutes); err != nil {
+		return store.Settings{}, err
+	}
+	prev, _ := e.store.GetSettings()
+	settings, err := e.store.UpdateSettings(patch)
+	if err != nil {
+		return store.Settings{}, err
+	}
+	if refreshMinutes(prev) != refreshMinutes(settings) {
+		e.rescheduleInheritedRefresh()
+	}
+	return settings, nil
+}
+
+// refreshMinutes — общий интервал из настроек; 0 — не задан.
+func refreshMinutes(s store.Settings) int {
+	if s.SubscriptionRefreshMinutes == nil {
+		return 0
+	}
+	return *s.SubscriptionRefreshMinutes
+}
+
+// rescheduleInheritedRefresh сбрасывает расписание подписок без своего интервала, чтобы новый общий
+// интервал применился сразу, а не после уже запланированного обновления.
+func (e *Engine) rescheduleInheritedRefresh() {
+	subs, err := e.store.GetSubscriptions()
+	if err != nil {
+		return
+	}
+	for _, sub := range subs {
+		if sub.RefreshMinutes != 0 || sub.NextRefreshAt == 0 {
+			continue
+		}
+		if err := e.store.UpdateSubscription(sub.ID, func(s *store.Subscription) {
+			if s.RefreshMinutes == 0 {
+				s.NextRefreshAt = 0
+			}
+		}); err != nil {
+			log.Printf("reschedule subscription %s: %v", sub.ID, err)
+		}
+	}
 }
 
 func (e *Engine) GetSingBoxStatus() singbox.Status {
@@ -186,6 +357,111 @@ func (e *Engine) AddSubscription(name, url string) (*store.Subscription, error)
 	return e.store.AddSubscription(name, url)
 }
 
+// ErrInvalidInput — изменение отклонено проверкой значений (API отвечает 400); текст ошибки объясняет, что не так.
+var ErrInvalidInput = errors.New("invalid input")
+
+// SubscriptionPatch — изменяемые пользователем поля подписки; nil — не менять.
+type SubscriptionPatch struct {
+	Name           *string           `json:"name,omitempty"`
+	RefreshMinutes *int              `json:"refresh_minutes,omitempty"`
+	UserAgent      *string           `json:"user_agent,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	AuthUser       *string           `json:"auth_user,omitempty"`
+	AuthPassword   *string           `json:"auth_password,omitempty"`
+	FetchVia       *string           `json:"fetch_via,omitempty"`
+	FetchProxy     *string           `json:"fetch_proxy,omitempty"`
+	// Rules — новые правила фильтрации/переименования; пустой объект снимает правила.
+	Rules *store.SubscriptionRules `json:"rules,omitempty"`
+}
+
+// UpdateSubscription меняет пользовательские настройки подписки.
+// При смене интервала расписание сбрасывается, чтобы новый интервал применился сразу.
+func (e *Engine) UpdateSubscription(id string, patch SubscriptionPatch) (*store.Subscription, error) {
+	if patch.FetchVia != nil {
+		switch *patch.FetchVia {
+		case "", store.FetchViaDirect, store.FetchViaTunnel:
+		case store.FetchViaProxy:
+			proxy := ""
+			if patch.FetchProxy != nil {
+				proxy = *patch.FetchProxy
+			} else {
+				sub, err := e.store.GetSubscription(id)
+				if err != nil {
+					return nil, err
+				}
+				proxy = sub.FetchProxy
+			}
+			if _, err := parseFetchProxy(proxy); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown fetch_via: %s", ErrInvalidInput, *patch.FetchVia)
+		}
+	}
+	if patch.RefreshMinutes != nil {
+		if err := validateRefreshMinutes("refresh_minutes", *patch.RefreshMinutes); err != nil {
+			return nil, err
+		}
+	}
+	if patch.Rules != nil {
+		if err := subscription.ValidateRules(*patch.Rules); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInput, err)
+		}
+	}
+	err := e.store.UpdateSubscription(id, func(s *store.Subscription) {
+		if patch.Name != nil && *patch.Name != "" {
+			s.Name = *patch.Name
+		}
+		if patch.RefreshMinutes != nil && *patch.RefreshMinutes != s.RefreshMinutes {
+			s.RefreshMinutes = *patch.RefreshMinutes
+			s.NextRefreshAt = 0
+		}
+		// От UA и заголовков зависит формат ответа — сбрасываем ETag, чтобы не получить 304 на старый формат.
+		requestChanged := false
+		if patch.UserAgent != nil {
+			s.UserAgent = *patch.UserAgent
+			requestChanged = true
+		}
+		if patch.Headers != nil {
+			s.Headers = patch.Headers
+			if len(s.Headers) == 0 {
+				s.Headers = nil
+			}
+			requestChanged = true
+		}
+		if patch.AuthUser != nil {
+			s.AuthUser = *patch.AuthUser
+			requestChanged = true
+		}
+		if patch.AuthPassword != nil {
+			s.AuthPassword = *patch.AuthPassword
+			requestChanged = true
+		}
+		if patch.FetchVia != nil {
+			s.FetchVia = *patch.FetchVia
+		}
+		if patch.FetchProxy != nil {
+			s.FetchProxy = *patch.FetchProxy
+		}
+		// Отфильтрованные узлы не сохраняются: чтобы новые правила их увидели, нужен полный ответ, а не 304.
+		if patch.Rules != nil {
+			s.Rules = patch.Rules
+			if isEmptyRules(*s.Rules) {
+				s.Rules = nil
+			}
+			requestChanged = true
+		}
+		if requestChanged {
+			s.ETag = ""
+			s.LastModified = ""
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.store.GetSubscription(id)
+}
+
 func (e *Engine) GetSubscriptions() ([]store.Subscription, error) {
 	return e.store.GetSubscriptions()
 }
@@ -195,7 +471,9 @@ func (e *Engine) GetServers() ([]store.ServerNode, error) {
 }
 
 // GetServersByConfigID возвращает серверы подписки с id=configID; если подписка не найдена — все серверы.
-// В список попадают только серверы с поддерживаемым sing-box URI (vmess/vless/trojan/ss, без xhttp и т.п.).
+// В список попадают только серверы, для которых собирается outbound: поддерживаемый sing-box URI
+// (vmess/vless/trojan/ss/hysteria2/tuic/wireguard; xhttp, mKCP и т.п. — нет, причина в отчёте подписки)
+// или готовый outbound (Clash YAML, sing-box JSON).
 // Всегда возвращает не-nil слайс.
 func (e *Engine) GetServersByConfigID(configID string) ([]store.ServerNode, error) {
 	var list []store.ServerNode
@@ -214,7 +492,7 @@ func (e *Engine) GetServersByConfigID(configID string) ([]store.ServerNode, erro
 	}
 	filtered := make([]store.ServerNode, 0, len(list))
 	for _, s := range list {
-		if IsURISupported(s.URI) {
+		if IsServerSupported(s) {
 			filtered = append(filtered, s)
 		}
 	}
@@ -223,25 +501,271 @@ func (e *Engine) GetServersByConfigID(configID string) ([]store.ServerNode, erro
 
 // RefreshResult — результат обновления одной подписки.
 type RefreshResult struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID     string             `json:"id"`
+	Status string             `json:"status"`
+	Diff   *subscription.Diff `json:"diff,omitempty"`
 }
 
 // RefreshSubscription загружает по URL подписки и обновляет список серверов.
-func (e *Engine) RefreshSubscription(subID string) error {
+// Исход (last_success / last_error) и время следующего автообновления сохраняются в подписке.
+// Возвращает, какие серверы добавились, пропали или сменили адрес/учётные данные.
+// Если пропал текущий сервер, это отражается в CurrentServerRemoved.
+func (e *Engine) RefreshSubscription(subID string) (*subscription.Diff, error) {
 	sub, err := e.store.GetSubscription(subID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	settings, _ := e.store.GetSettings()
+	res, err := e.fetchAndParse(sub)
+	if err != nil {
+		_ = e.store.UpdateSubscription(subID, func(s *store.Subscription) {
+			recordRefresh(s, settings, e.clock.Now(), err)
+		})
+		return nil, err
+	}
+	var diff subscription.Diff
+	err = e.store.UpdateSubscription(subID, func(s *store.Subscription) {
+		// 304: список серверов и метаданные прежние, только отмечаем успешную проверку.
+		if res.notModified {
+			diff = subscription.UnchangedDiff(s.Servers)
+		} else {
+			diff = subscription.DiffServers(s.Servers, res.servers)
+			carryPings(s.Servers, res.servers)
+			s.Servers = res.servers
+			applySubscriptionInfo(s, res.info)
+		}
+		s.ETag = res.etag
+		s.LastModified = res.lastModified
+		recordRefresh(s, settings, e.clock.Now(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cur := e.GetCurrentServer(); cur != nil && diff.Affects(cur.ID) {
+		log.Printf("current server %s is gone from subscription %s", cur.Name, subID)
+		e.setCurrentRemoved(true)
+	}
+	return &diff, nil
+}
+
+// GetSubscriptionReport возвращает построчный отчёт о разборе подписки: принятые строки,
+// неподдерживаемые схемы и транспорты, битые ссылки. Если с запуска тело ещё не загружалось
+// (или провайдер отвечал 304), отчёт строится по сохранённым серверам.
+func (e *Engine) GetSubscriptionReport(subID string) (*subscription.Report, error) {
+	if p := e.getParsed(subID); p != nil {
+		return p.report, nil
+	}
+	sub, err := e.store.GetSubscription(subID)
+	if err != nil {
+		return nil, err
+	}
+	return subscription.ReportFromServers(sub.Servers, CheckServer), nil
+}
+
+// PreviewSubscriptionRules показывает, какие серверы подписки оставят правила, ничего не сохраняя.
+// Правила применяются к списку до текущих фильтров; если его нет в памяти, подписка загружается заново.
+func (e *Engine) PreviewSubscriptionRules(subID string, rules store.SubscriptionRules) (*subscription.RulesPreview, error) {
+	if err := subscription.ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	p := e.getParsed(subID)
+	if p == nil || p.servers == nil {
+		sub, err := e.store.GetSubscription(subID)
+		if err != nil {
+			return nil, err
+		}
+		// Без условного запроса: нужен полный список, а не 304.
+		sub.Servers = nil
+		if _, err := e.fetchAndParse(sub); err != nil {
+			return nil, err
+		}
+		p = e.getParsed(subID)
+	}
+	return subscription.PreviewRules(p.servers, rules)
+}
+
+type parsedSubscription struct {
+	report  *subscription.Report
+	servers []store.ServerNode
+}
+
+func (e *Engine) getParsed(subID string) *parsedSubscription {
+	e.parsedMu.Lock()
+	defer e.parsedMu.Unlock()
+	return e.parsed[subID]
+}
+
+func (e *Engine) setParsed(subID string, p *parsedSubscription) {
+	e.parsedMu.Lock()
+	defer e.parsedMu.Unlock()
+	if p == nil {
+		delete(e.parsed, subID)
+		return
+	}
+	if e.parsed == nil {
+		e.parsed = make(map[string]*parsedSubscription)
 	}
-	body, err := subscription.Fetch(sub.URL)
+	e.parsed[subID] = p
+}
+
+type fetchedSubscription struct {
+	servers      []store.ServerNode
+	info         subscription.Info
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+func (e *Engine) fetchAndParse(sub *store.Subscription) (*fetchedSubscription, error) {
+	if sub.URL == "" {
+		return e.parseLocal(sub)
+	}
+	opts := subscription.Options{
+		UserAgent: sub.UserAgent,
+		Headers:   sub.Headers,
+		Username:  sub.AuthUser,
+		Password:  sub.AuthPassword,
+		After:     e.clock.After,
+	}
+	// Условный запрос только если серверы уже есть: иначе 304 оставил бы подписку пустой.
+	if len(sub.Servers) > 0 {
+		opts.ETag = sub.ETag
+		opts.LastModified = sub.LastModified
+	}
+	res, err := e.fetchSubscription(sub, opts)
 	if err != nil {
-		return fmt.Errorf("fetch: %w", err)
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	out := &fetchedSubscription{
+		etag:         res.ETag,
+		lastModified: res.LastModified,
+		notModified:  res.NotModified,
+	}
+	if res.NotModified {
+		return out, nil
 	}
-	servers, err := subscription.ParseContent(body)
+	servers, err := e.parseServers(sub, res.Body)
 	if err != nil {
-		return fmt.Errorf("parse: %w", err)
+		return nil, err
+	}
+	out.servers = servers
+	out.info = res.Info
+	return out, nil
+}
+
+// parseLocal разбирает тело локального конфига (подписки без URL).
+func (e *Engine) parseLocal(sub *store.Subscription) (*fetchedSubscription, error) {
+	if strings.TrimSpace(sub.Content) == "" {
+		return nil, fmt.Errorf("subscription has neither url nor content")
+	}
+	servers, err := e.parseServers(sub, sub.Content)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers found in config")
+	}
+	return &fetchedSubscription{servers: servers}, nil
+}
+
+// parseServers разбирает тело подписки, дополняет страны по GeoIP и применяет правила подписки.
+func (e *Engine) parseServers(sub *store.Subscription, body string) ([]store.ServerNode, error) {
+	servers, report, err := subscription.ParseContentReport(body, CheckServer)
+	e.setParsed(sub.ID, &parsedSubscription{report: report, servers: servers})
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	e.fillCountriesFromGeoIP(servers)
+	// Правила подписки (фильтры, переименование) — до сохранения; исходный список остаётся в памяти.
+	servers, err = subscription.ApplyRules(servers, sub.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	return servers, nil
+}
+
+func isEmptyRules(r store.SubscriptionRules) bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0 && r.Rename == "" && r.Prefix == ""
+}
+
+// fetchSubscription загружает подписку согласно sub.FetchVia. По умолчанию — напрямую,
+// а если панель провайдера недоступна и VPN подключён — повторно через наш mixed inbound.
+func (e *Engine) fetchSubscription(sub *store.Subscription, opts subscription.Options) (*subscription.Result, error) {
+	switch sub.FetchVia {
+	case store.FetchViaTunnel:
+		proxy, err := e.tunnelProxyURL()
+		if err != nil {
+			return nil, err
+		}
+		opts.Proxy = proxy
+		return subscription.Fetch(sub.URL, opts)
+	case store.FetchViaProxy:
+		proxy, err := parseFetchProxy(sub.FetchProxy)
+		if err != nil {
+			return nil, err
+		}
+		opts.Proxy = proxy
+		return subscription.Fetch(sub.URL, opts)
+	}
+
+	res, err := subscription.Fetch(sub.URL, opts)
+	if err == nil {
+		return res, nil
+	}
+	proxy, tunnelErr := e.tunnelProxyURL()
+	if tunnelErr != nil {
+		return nil, err
+	}
+	log.Printf("subscription %s: direct fetch failed (%v), retrying via tunnel", sub.ID, err)
+	opts.Proxy = proxy
+	res, viaErr := subscription.Fetch(sub.URL, opts)
+	if viaErr != nil {
+		return nil, fmt.Errorf("%w; via tunnel: %v", err, viaErr)
+	}
+	return res, nil
+}
+
+// tunnelProxyURL — адрес mixed inbound запущенного sing-box; ошибка, если VPN не подключён.
+func (e *Engine) tunnelProxyURL() (*url.URL, error) {
+	if e.GetStatus() != Connected {
+		return nil, fmt.Errorf("tunnel is not running")
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(proxyPort))}, nil
+}
+
+// parseFetchProxy проверяет явный прокси для загрузки подписки (http, https, socks5, socks5h).
+func parseFetchProxy(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("fetch proxy url is empty")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("fetch proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported fetch proxy scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("fetch proxy url: missing host")
+	}
+	return u, nil
+}
+
+// applySubscriptionInfo переносит метаданные из заголовков в подписку.
+// Имя меняем на profile-title только если пользователь его не задавал (по умолчанию имя = URL).
+func applySubscriptionInfo(s *store.Subscription, info subscription.Info) {
+	s.Upload = info.Upload
+	s.Download = info.Download
+	s.Total = info.Total
+	s.ExpiresAt = info.Expire
+	s.ProfileTitle = info.Title
+	s.UpdateInterval = info.UpdateInterval
+	s.WebPageURL = info.WebPageURL
+	if info.Title != "" && (s.Name == "" || s.Name == s.URL) {
+		s.Name = info.Title
 	}
-	return e.store.UpdateSubscriptionServers(subID, servers)
 }
 
 // RefreshAllSubscriptions обновляет серверы для всех подписок.
@@ -252,12 +776,12 @@ func (e *Engine) RefreshAllSubscriptions() []RefreshResult {
 	}
 	results := make([]RefreshResult, 0, len(subs))
 	for _, sub := range subs {
-		err := e.RefreshSubscription(sub.ID)
+		diff, err := e.RefreshSubscription(sub.ID)
 		if err != nil {
 			log.Printf("refresh subscription %s: %v", sub.ID, err)
 			results = append(results, RefreshResult{ID: sub.ID, Status: err.Error()})
 		} else {
-			results = append(results, RefreshResult{ID: sub.ID, Status: "ok"})
+			results = append(results, RefreshResult{ID: sub.ID, Status: "ok", Diff: diff})
 		}
 	}
 	return results
@@ -275,7 +799,7 @@ func (e *Engine) Connect(serverID string) error {
 		e.setStatus(Error)
 		return fmt.Errorf("server not found: %s", serverID)
 	}
-	if server.URI == "" {
+	if server.URI == "" && server.Outbound == nil {
 		e.setStatus(Error)
 		return fmt.Errorf("server has no uri (refresh subscription to fetch full links)")
 	}
@@ -310,8 +834,7 @@ func (e *Engine) Connect(serverID string) error {
 	}
 
 	// Ждём, пока sing-box поднимет mixed inbound на 127.0.0.1:7890 — только потом включаем системный прокси.
-	const proxyPort = 7890
-	if err := e.waitForProxyPort("127.0.0.1", proxyPort, 15*time.Second, &stderrBuf); err != nil {
+	if err := waitForProxyPort(e.process, "127.0.0.1", proxyPort, 15*time.Second, &stderrBuf); err != nil {
 		_ = e.process.Process.Kill()
 		_ = e.process.Wait()
 		e.process = nil
@@ -321,7 +844,8 @@ func (e *Engine) Connect(serverID string) error {
 
 	setSystemProxy("127.0.0.1", proxyPort)
 
-	e.currentNode = server
+	e.setCurrentServer(server)
+	e.setCurrentRemoved(false)
 	e.setStatus(Connected)
 	if server.ID != "" {
 		_, _ = e.store.UpdateSettings(store.Settings{LastConnectedServerID: server.ID})
@@ -330,12 +854,12 @@ func (e *Engine) Connect(serverID string) error {
 	return nil
 }
 
-// waitForProxyPort ждёт, пока на host:port появится слушатель (sing-box mixed inbound).
-func (e *Engine) waitForProxyPort(host string, port int, timeout time.Duration, stderr *bytes.Buffer) error {
+// waitForProxyPort ждёт, пока процесс sing-box cmd поднимет слушатель на host:port (mixed inbound).
+func waitForProxyPort(cmd *exec.Cmd, host string, port int, timeout time.Duration, stderr *bytes.Buffer) error {
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	deadline := time.Now().Add(timeout)
 	exitCh := make(chan error, 1)
-	go func() { exitCh <- e.process.Wait() }()
+	go func() { exitCh <- cmd.Wait() }()
 
 	for time.Now().Before(deadline) {
 		conn, err := net.DialTimeout("tcp", addr, 400*time.Millisecond)
@@ -384,7 +908,8 @@ func (e *Engine) Disconnect() error {
 		_ = os.Remove(e.lastConfigPath)
 		e.lastConfigPath = ""
 	}
-	e.currentNode = nil
+	e.setCurrentServer(nil)
+	e.setCurrentRemoved(false)
 	e.setStatus(Disconnected)
 	log.Println("Disconnected")
 	return nil
@@ -395,18 +920,33 @@ func (e *Engine) GetTotalTraffic() (store.TotalTrafficStats, error) {
 }
 
 func (e *Engine) DeleteSubscription(id string) error {
+	// Серверы подписки, через которые (detour) подключаются другие серверы, не удаляются, чтобы не рвать цепочки.
+	if sub, err := e.store.GetSubscription(id); err == nil {
+		ids := make(map[string]bool, len(sub.Servers))
+		for _, n := range sub.Servers {
+			ids[n.ID] = true
+		}
+		users, err := e.detourUsers(ids)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			return fmt.Errorf("%w: detour of %s", ErrServerInUse, strings.Join(users, ", "))
+		}
+	}
 	// Если подключены к серверу из этой подписки — отключаемся.
-	if e.currentNode != nil {
+	if cur := e.GetCurrentServer(); cur != nil {
 		sub, _ := e.store.GetSubscription(id)
 		if sub != nil {
 			for _, n := range sub.Servers {
-				if n.ID == e.currentNode.ID || n.Name == e.currentNode.Name {
+				if n.ID == cur.ID || n.Name == cur.Name {
 					_ = e.Disconnect()
 					break
 				}
 			}
 		}
 	}
+	e.setParsed(id, nil)
 	return e.store.DeleteSubscription(id)
 }
 
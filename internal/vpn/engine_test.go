@@ -0,0 +1,218 @@
+package vpn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+func TestUpdateSubscriptionErrors(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	sub, err := e.AddSubscription("test", "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+
+	tests := []struct {
+		name  string
+		id    string
+		patch SubscriptionPatch
+		want  error
+	}{
+		{"unknown subscription", "missing", SubscriptionPatch{Name: str("x")}, store.ErrSubscriptionNotFound},
+		{"unknown subscription with proxy", "missing", SubscriptionPatch{FetchVia: str(store.FetchViaProxy)}, store.ErrSubscriptionNotFound},
+		{"unknown fetch_via", sub.ID, SubscriptionPatch{FetchVia: str("carrier-pigeon")}, ErrInvalidInput},
+		{"proxy without address", sub.ID, SubscriptionPatch{FetchVia: str(store.FetchViaProxy)}, ErrInvalidInput},
+		{"interval too short", sub.ID, SubscriptionPatch{RefreshMinutes: num(1)}, ErrInvalidInput},
+		{"interval ok", sub.ID, SubscriptionPatch{RefreshMinutes: num(minRefreshMinutes)}, nil},
+		{"auto-refresh disabled", sub.ID, SubscriptionPatch{RefreshMinutes: num(-1)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.UpdateSubscription(tt.id, tt.patch)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("UpdateSubscription: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateSubscription: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSettingsFingerprint(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	if _, err := e.UpdateSettings(store.Settings{UTLSFingerprint: "netscape"}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("UpdateSettings(netscape): %v, want ErrInvalidInput", err)
+	}
+	settings, err := e.UpdateSettings(store.Settings{UTLSFingerprint: " Firefox "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.UTLSFingerprint != "firefox" {
+		t.Errorf("utls_fingerprint = %q, want firefox", settings.UTLSFingerprint)
+	}
+}
+
+func TestDeleteManualServerInUse(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	hop, err := e.AddManualServer(ManualServerRequest{URI: "ss://YWVzLTI1Ni1nY206c2VjcmV0@1.2.3.4:8388#hop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exit, err := e.AddManualServer(ManualServerRequest{Name: "exit", Outbound: map[string]any{
+		"type": "shadowsocks", "server": "5.6.7.8", "server_port": 8388,
+		"method": "aes-256-gcm", "password": "secret", "detour": hop.ID,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.DeleteManualServer(hop.ID); !errors.Is(err, ErrServerInUse) {
+		t.Fatalf("DeleteManualServer(hop): %v, want ErrServerInUse", err)
+	}
+	if _, err := st.GetServer(hop.ID); err != nil {
+		t.Fatalf("hop was deleted: %v", err)
+	}
+	if err := e.DeleteManualServer("missing"); !errors.Is(err, store.ErrServerNotFound) {
+		t.Errorf("DeleteManualServer(missing): %v, want ErrServerNotFound", err)
+	}
+	// Без ссылок на него сервер удаляется.
+	if err := e.DeleteManualServer(exit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DeleteManualServer(hop.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteSubscriptionInUse(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	sub, err := st.AddSubscription("sub", "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := map[string]any{"type": "shadowsocks", "server": "1.2.3.4", "server_port": 8388, "method": "aes-256-gcm", "password": "secret"}
+	// Цепочка внутри подписки удалению не мешает.
+	if err := st.UpdateSubscriptionServers(sub.ID, []store.ServerNode{
+		{ID: "hop", Name: "hop", Outbound: ss},
+		{ID: "inner", Name: "inner", Outbound: map[string]any{"type": "socks", "server": "5.6.7.8", "server_port": 1080, "detour": "hop"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	exit, err := e.AddManualServer(ManualServerRequest{Name: "exit", Outbound: map[string]any{
+		"type": "shadowsocks", "server": "5.6.7.8", "server_port": 8388,
+		"method": "aes-256-gcm", "password": "secret", "detour": "hop",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.DeleteSubscription(sub.ID); !errors.Is(err, ErrServerInUse) {
+		t.Fatalf("DeleteSubscription: %v, want ErrServerInUse", err)
+	}
+	if _, err := st.GetSubscription(sub.ID); err != nil {
+		t.Fatalf("subscription was deleted: %v", err)
+	}
+	if err := e.DeleteManualServer(exit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.DeleteSubscription(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateServersRemapsDetours(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := st.AddSubscription("old", "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Узлы со старыми ID (имя-хост): exit подключается через hop.
+	hop := store.ServerNode{ID: "hop-1.2.3.4", Name: "hop", Address: "1.2.3.4",
+		URI: "ss://YWVzLTI1Ni1nY206c2VjcmV0@1.2.3.4:8388#hop"}
+	exit := store.ServerNode{ID: "exit-5.6.7.8", Name: "exit", Address: "5.6.7.8", Outbound: map[string]any{
+		"type": "shadowsocks", "tag": "exit", "server": "5.6.7.8", "server_port": 8388,
+		"method": "aes-256-gcm", "password": "secret", "detour": hop.ID,
+	}}
+	if err := st.UpdateSubscriptionServers(sub.ID, []store.ServerNode{hop, exit}); err != nil {
+		t.Fatal(err)
+	}
+	manual := store.ServerNode{ID: "manual-chain", Name: "chain", Address: "9.9.9.9", Outbound: map[string]any{
+		"type": "shadowsocks", "tag": "chain", "server": "9.9.9.9", "server_port": 8388,
+		"method": "aes-256-gcm", "password": "secret", "detour": exit.ID,
+	}}
+	if err := st.AddServer(manual); err != nil {
+		t.Fatal(err)
+	}
+
+	NewEngine(st)
+
+	migrated, err := st.GetSubscription(sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHop, newExit := migrated.Servers[0], migrated.Servers[1]
+	if newHop.ID == hop.ID || newExit.ID == exit.ID {
+		t.Fatalf("ids were not migrated: %s, %s", newHop.ID, newExit.ID)
+	}
+	if got := newExit.Outbound["detour"]; got != newHop.ID {
+		t.Errorf("exit detour = %v, want %s", got, newHop.ID)
+	}
+	chain, err := st.GetServer(manual.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.Outbound["detour"]; got != newExit.ID {
+		t.Errorf("manual detour = %v, want %s", got, newExit.ID)
+	}
+}
+
+func TestSubscriptionErrorClasses(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(st)
+	remote, err := e.AddSubscription("remote", "https://example.com/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RefreshSubscription("missing"); !errors.Is(err, store.ErrSubscriptionNotFound) {
+		t.Errorf("RefreshSubscription(missing): %v, want ErrSubscriptionNotFound", err)
+	}
+	if _, _, _, err := e.ExportSubscription("missing", ExportURI); !errors.Is(err, store.ErrSubscriptionNotFound) {
+		t.Errorf("ExportSubscription(missing): %v, want ErrSubscriptionNotFound", err)
+	}
+	if err := e.DeleteConfig("missing"); !errors.Is(err, store.ErrSubscriptionNotFound) {
+		t.Errorf("DeleteConfig(missing): %v, want ErrSubscriptionNotFound", err)
+	}
+	if err := e.DeleteConfig(remote.ID); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("DeleteConfig(remote subscription): %v, want ErrInvalidInput", err)
+	}
+}
@@ -0,0 +1,485 @@
+package vpn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+)
+
+// Способы замера задержки (PingRequest.Mode).
+const (
+	// PingTCP — время установки TCP-соединения с адресом сервера (DNS не учитывается).
+	// Быстро и без sing-box, но не проверяет, что сервер действительно проксирует; для протоколов поверх UDP не подходит.
+	PingTCP = "tcp"
+	// PingURL — HTTP-запрос через сервер во временном sing-box, как urltest в самом sing-box.
+	PingURL = "url"
+)
+
+const (
+	// pingWorkers — сколько серверов замеряется одновременно.
+	pingWorkers = 16
+	// pingTimeout — сколько ждать ответа одного сервера.
+	pingTimeout = 5 * time.Second
+	// pingTestURL — адрес для PingURL по умолчанию: отвечает 204 без тела.
+	pingTestURL = "https://www.gstatic.com/generate_204"
+	// pingFailed — Ping сервера, который не ответил.
+	pingFailed = -1
+)
+
+// PingRequest — какие серверы и как замерять.
+type PingRequest struct {
+	// IDs — серверы для замера; пусто — все.
+	IDs []string `json:"ids,omitempty"`
+	// Mode — PingTCP (по умолчанию) или PingURL.
+	Mode string `json:"mode,omitempty"`
+	// URL — адрес для PingURL; по умолчанию pingTestURL (тогда успех — только ответ 204).
+	URL string `json:"url,omitempty"`
+}
+
+// PingResult — замер одного сервера.
+type PingResult struct {
+	ID string `json:"id"`
+	// Ping — задержка в мс; -1 — сервер не ответил (причина в Error); 0 — замер неприменим (UDP-протокол в режиме tcp).
+	Ping     int    `json:"ping"`
+	PingedAt int64  `json:"pinged_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// errNoTCPPing — TCP-замер к серверу неприменим; прежний Ping такого сервера не затирается.
+var errNoTCPPing = errors.New("server works over UDP, use the url ping mode")
+
+// pingProbe замеряет i-й сервер из списка.
+type pingProbe func(ctx context.Context, i int) (time.Duration, error)
+
+// PingServers замеряет задержку серверов (не больше pingWorkers одновременно) и передаёт каждый результат в onResult,
+// как только он готов; onResult вызывается последовательно, из горутины вызывающего.
+// Ошибки запроса (неизвестный сервер или режим, нет sing-box) возвращаются до первого результата.
+// Результаты сохраняются в ServerNode.Ping/PingedAt; при отмене ctx — только для уже замеренных серверов.
+func (e *Engine) PingServers(ctx context.Context, req PingRequest, onResult func(PingResult)) error {
+	servers, err := e.pingTargets(req.IDs)
+	if err != nil {
+		return err
+	}
+	var probe pingProbe
+	switch req.Mode {
+	case "", PingTCP:
+		probe = func(ctx context.Context, i int) (time.Duration, error) {
+			return tcpPing(ctx, &servers[i])
+		}
+	case PingURL:
+		var stop func()
+		probe, stop, err = e.urlPingProbe(ctx, servers, req.URL)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	default:
+		return fmt.Errorf("unknown ping mode: %s", req.Mode)
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	jobs := make(chan int)
+	results := make(chan PingResult)
+	var wg sync.WaitGroup
+	for range min(pingWorkers, len(servers)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				elapsed, err := probe(ctx, i)
+				if ctx.Err() != nil {
+					// Замер прерван, а не сервер не ответил — такой результат не сохраняем.
+					continue
+				}
+				r := PingResult{ID: servers[i].ID}
+				switch {
+				case errors.Is(err, errNoTCPPing):
+					r.Error = err.Error()
+				case err != nil:
+					r.Ping, r.Error = pingFailed, err.Error()
+				default:
+					// 0 зарезервирован за «не измерялась».
+					r.Ping = max(1, int(elapsed.Milliseconds()))
+				}
+				if r.Ping != 0 {
+					r.PingedAt = e.clock.Now().Unix()
+				}
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range servers {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pings := map[string]int{}
+	var at int64
+	for r := range results {
+		if r.Ping != 0 {
+			pings[r.ID], at = r.Ping, r.PingedAt
+		}
+		onResult(r)
+	}
+	if len(pings) > 0 {
+		if err := e.store.UpdatePings(pings, at); err != nil {
+			return err
+		}
+		e.notify(map[string]interface{}{"type": "servers_pinged"})
+	}
+	return ctx.Err()
+}
+
+// pingTargets — серверы по ID без повторов (пусто — все серверы).
+func (e *Engine) pingTargets(ids []string) ([]store.ServerNode, error) {
+	if len(ids) == 0 {
+		return e.store.GetServers()
+	}
+	var servers []store.ServerNode
+	seen := map[string]bool{}
+	for _, id := range ids {
+		server, err := e.store.GetServer(id)
+		if err != nil {
+			return nil, err
+		}
+		if seen[server.ID] {
+			continue
+		}
+		seen[server.ID] = true
+		servers = append(servers, *server)
+	}
+	return servers, nil
+}
+
+// carryPings переносит последний замер из прежнего списка узлов подписки в новый (по ID),
+// чтобы обновление подписки не сбрасывало Ping.
+func carryPings(old, fresh []store.ServerNode) {
+	prev := make(map[string]store.ServerNode, len(old))
+	for _, n := range old {
+		prev[n.ID] = n
+	}
+	for i := range fresh {
+		if n, ok := prev[fresh[i].ID]; ok {
+			fresh[i].Ping, fresh[i].PingedAt = n.Ping, n.PingedAt
+		}
+	}
+}
+
+// udpTransport — outbound ходит к серверу по UDP, и TCP-замер для него ничего не говорит.
+func udpTransport(ob map[string]any) bool {
+	switch ob["type"] {
+	case "hysteria", "hysteria2", "tuic", "wireguard":
+		return true
+	case "naive":
+		quic, _ := ob["quic"].(bool)
+		return quic
+	}
+	transport, _ := ob["transport"].(map[string]any)
+	return transport != nil && transport["type"] == "quic"
+}
+
+// tcpPing замеряет время TCP-рукопожатия с адресом сервера. Имя резолвится заранее, чтобы в замер не попал DNS.
+func tcpPing(ctx context.Context, server *store.ServerNode) (time.Duration, error) {
+	ob, err := serverOutbound(server)
+	if err != nil {
+		return 0, err
+	}
+	if udpTransport(ob) {
+		return 0, fmt.Errorf("%s: %w", ob["type"], errNoTCPPing)
+	}
+	host, _ := ob["server"].(string)
+	port := 0
+	switch p := ob["server_port"].(type) {
+	case int:
+		port = p
+	case float64:
+		port = int(p)
+	}
+	if host == "" || port == 0 {
+		return 0, fmt.Errorf("server has no address")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return 0, err
+	}
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ips[0].IP.String(), strconv.Itoa(port)))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return elapsed, nil
+}
+
+// urlPingProbe поднимает для PingURL один sing-box на все серверы (см. startURLTester) и возвращает замер
+// и функцию, которая его останавливает. Если общий sing-box не запустился — обычно его роняет один неподходящий
+// узел, — список делится пополам, пока виноватые узлы не останутся по одному (см. bisectURLTesters).
+func (e *Engine) urlPingProbe(ctx context.Context, servers []store.ServerNode, target string) (pingProbe, func(), error) {
+	strict := target == ""
+	if strict {
+		target = pingTestURL
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil, fmt.Errorf("invalid ping url: %s", target)
+	}
+	status := e.GetSingBoxStatus()
+	if !status.Installed || status.Path == "" {
+		return nil, nil, fmt.Errorf("sing-box not found: install via UI or set NEKKUS_SINGBOX_PATH / settings.sing_box_path")
+	}
+	if len(servers) == 0 {
+		return nil, func() {}, nil
+	}
+
+	slots, testers := bisectURLTesters(ctx, len(servers), func(lo, hi int) (*urlTester, error) {
+		return e.startURLTester(ctx, status.Path, servers[lo:hi])
+	})
+	if len(servers) > 1 && len(testers) != 1 {
+		log.Printf("url ping: shared sing-box failed, testing servers in %d sing-box processes", len(testers))
+	}
+	probe := func(ctx context.Context, i int) (time.Duration, error) {
+		s := slots[i]
+		if s.err != nil {
+			return 0, s.err
+		}
+		return s.tester.ping(ctx, s.index, target, strict)
+	}
+	stop := func() {
+		for _, t := range testers {
+			t.close()
+		}
+	}
+	return probe, stop, nil
+}
+
+// testerSlot — чем замеряется сервер: тестер и индекс сервера в нём или ошибка запуска sing-box.
+type testerSlot struct {
+	tester *urlTester
+	index  int
+	err    error
+}
+
+// bisectURLTesters запускает тестер на все n серверов; если sing-box не поднялся, каждая половина пробуется
+// отдельно, и так до одиночных узлов — они получают ошибку запуска, остальные замеряются.
+// Для k неподходящих узлов это O(k·log n) процессов, а не по одному на сервер.
+func bisectURLTesters(ctx context.Context, n int, start func(lo, hi int) (*urlTester, error)) ([]testerSlot, []*urlTester) {
+	slots := make([]testerSlot, n)
+	var testers []*urlTester
+	var split func(lo, hi int)
+	split = func(lo, hi int) {
+		t, err := start(lo, hi)
+		if err == nil {
+			testers = append(testers, t)
+			for i := lo; i < hi; i++ {
+				slots[i] = testerSlot{tester: t, index: i - lo}
+			}
+			return
+		}
+		if hi-lo == 1 || ctx.Err() != nil {
+			for i := lo; i < hi; i++ {
+				slots[i] = testerSlot{err: err}
+			}
+			return
+		}
+		mid := (lo + hi) / 2
+		split(lo, mid)
+		split(mid, hi)
+	}
+	split(0, n)
+	return slots, testers
+}
+
+// urlTester — временный sing-box для PingURL: один mixed inbound на 127.0.0.1, у каждого сервера
+// свой пользователь, и правило маршрута отправляет соединения этого пользователя в outbound сервера.
+type urlTester struct {
+	cmd      *exec.Cmd
+	cfgPath  string
+	port     int
+	password string
+	// users — пользователь inbound для сервера с этим индексом.
+	users map[int]string
+	// buildErr — почему для сервера не собрался outbound (в sing-box он не попал).
+	buildErr map[int]error
+}
+
+// startURLTester запускает sing-box с outbound-ами servers (с цепочками detour) и ждёт, пока поднимется inbound.
+// Процесс завершается в close или при отмене ctx.
+func (e *Engine) startURLTester(ctx context.Context, singBoxPath string, servers []store.ServerNode) (*urlTester, error) {
+	t := &urlTester{users: map[int]string{}, buildErr: map[int]error{}}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	t.password = hex.EncodeToString(secret)
+
+	cfg := singBoxConfig{
+		Log: map[string]any{"level": "error"},
+	}
+	var users, rules []map[string]any
+	for i := range servers {
+		tag := "s" + strconv.Itoa(i)
+		ob, err := e.outboundFor(&servers[i])
+		var chain []map[string]any
+		if err == nil {
+			ob["tag"] = tag
+			chain, err = e.detourChain(ob, tag+"-detour", servers[i].ID)
+		}
+		if err != nil {
+			t.buildErr[i] = err
+			continue
+		}
+		for _, ob := range append([]map[string]any{ob}, chain...) {
+			if isEndpointType(ob["type"]) {
+				cfg.Endpoints = append(cfg.Endpoints, ob)
+			} else {
+				cfg.Outbounds = append(cfg.Outbounds, ob)
+			}
+		}
+		users = append(users, map[string]any{"username": tag, "password": t.password})
+		rules = append(rules, map[string]any{"auth_user": []string{tag}, "outbound": tag})
+		t.users[i] = tag
+	}
+	if len(users) == 0 {
+		// Запускать нечего: ping вернёт buildErr.
+		return t, nil
+	}
+
+	port, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	t.port = port
+	cfg.Inbounds = []map[string]any{{
+		"type":        "mixed",
+		"tag":         "ping-in",
+		"listen":      "127.0.0.1",
+		"listen_port": port,
+		"users":       users,
+	}}
+	cfg.Outbounds = append(cfg.Outbounds, map[string]any{"type": "block", "tag": "block"})
+	cfg.Route = map[string]any{"rules": rules, "final": "block"}
+
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(e.store.DataDir(), "runtime")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "sing-box-ping-*.json")
+	if err != nil {
+		return nil, err
+	}
+	t.cfgPath = f.Name()
+	_, err = f.Write(encoded)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(t.cfgPath)
+		return nil, err
+	}
+
+	t.cmd = exec.CommandContext(ctx, singBoxPath, "run", "-c", t.cfgPath)
+	setProcessNoWindow(t.cmd)
+	var stderr bytes.Buffer
+	t.cmd.Stderr = &stderr
+	if err := t.cmd.Start(); err != nil {
+		_ = os.Remove(t.cfgPath)
+		return nil, fmt.Errorf("sing-box start error: %w", err)
+	}
+	// waitForProxyPort сам ждёт завершения процесса (cmd.Wait), поэтому после Kill его не нужно дожидаться.
+	if err := waitForProxyPort(t.cmd, "127.0.0.1", port, 15*time.Second, &stderr); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// ping выполняет GET target через i-й сервер и возвращает время до ответа.
+// strict — нужен именно 204 (адрес по умолчанию), иначе подходит любой ответ без ошибки (< 400).
+func (t *urlTester) ping(ctx context.Context, i int, target string, strict bool) (time.Duration, error) {
+	if err := t.buildErr[i]; err != nil {
+		return 0, err
+	}
+	proxy := &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(t.users[i], t.password),
+		Host:   net.JoinHostPort("127.0.0.1", strconv.Itoa(t.port)),
+	}
+	client := &http.Client{
+		Timeout:   pingTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxy), DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	resp.Body.Close()
+	if (strict && resp.StatusCode != http.StatusNoContent) || resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return elapsed, nil
+}
+
+// close останавливает sing-box и удаляет его конфиг; повторный вызов ничего не делает.
+func (t *urlTester) close() {
+	if t.cmd != nil && t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
+	}
+	if t.cfgPath != "" {
+		_ = os.Remove(t.cfgPath)
+	}
+}
+
+// freeLocalPort — свободный TCP-порт на 127.0.0.1 для inbound временного sing-box.
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,82 @@
+package vpn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Общий sing-box роняют узлы из bad: деление пополам изолирует их, не запуская процесс на каждый сервер.
+func TestBisectURLTesters(t *testing.T) {
+	tests := []struct {
+		n        int
+		bad      []int
+		maxStart int
+	}{
+		{n: 16},
+		{n: 16, bad: []int{5}, maxStart: 9},
+		{n: 16, bad: []int{0, 15}, maxStart: 15},
+		{n: 7, bad: []int{3, 4}},
+		{n: 1, bad: []int{0}},
+		{n: 3, bad: []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d servers, bad %v", tt.n, tt.bad), func(t *testing.T) {
+			bad := map[int]bool{}
+			for _, i := range tt.bad {
+				bad[i] = true
+			}
+			starts := 0
+			slots, testers := bisectURLTesters(context.Background(), tt.n, func(lo, hi int) (*urlTester, error) {
+				starts++
+				for i := lo; i < hi; i++ {
+					if bad[i] {
+						return nil, fmt.Errorf("server %d broke sing-box", i)
+					}
+				}
+				return &urlTester{users: map[int]string{}}, nil
+			})
+			if tt.maxStart > 0 && starts > tt.maxStart {
+				t.Errorf("started sing-box %d times, want at most %d", starts, tt.maxStart)
+			}
+			covered := 0
+			for i, s := range slots {
+				switch {
+				case bad[i]:
+					if want := fmt.Sprintf("server %d broke sing-box", i); s.err == nil || s.err.Error() != want {
+						t.Errorf("slot %d: err = %v, want %q", i, s.err, want)
+					}
+				case s.err != nil || s.tester == nil:
+					t.Errorf("slot %d: good server has no tester (err %v)", i, s.err)
+				default:
+					covered++
+				}
+			}
+			if covered != tt.n-len(tt.bad) {
+				t.Errorf("%d good servers covered, want %d", covered, tt.n-len(tt.bad))
+			}
+			if len(tt.bad) == 0 && len(testers) != 1 {
+				t.Errorf("testers = %d, want one shared", len(testers))
+			}
+		})
+	}
+}
+
+func TestBisectURLTestersCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	starts := 0
+	slots, _ := bisectURLTesters(ctx, 8, func(lo, hi int) (*urlTester, error) {
+		starts++
+		return nil, ctx.Err()
+	})
+	if starts != 1 {
+		t.Errorf("started sing-box %d times after cancel, want 1", starts)
+	}
+	for i, s := range slots {
+		if !errors.Is(s.err, context.Canceled) {
+			t.Errorf("slot %d: err = %v", i, s.err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package vpn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// manualIDPrefix отличает ручные серверы от узлов подписок с тем же отпечатком.
+const manualIDPrefix = "manual-"
+
+// ManualServerRequest — тело POST/PUT /api/servers: одна share-ссылка или сырой outbound sing-box и, по желанию, имя.
+type ManualServerRequest struct {
+	URI string `json:"uri,omitempty"`
+	// Outbound — outbound sing-box как есть, без разбора ссылки (вместо URI). tag становится именем,
+	// detour может ссылаться на ID другого сохранённого сервера — так собираются цепочки.
+	Outbound map[string]any `json:"outbound,omitempty"`
+	Name     string         `json:"name,omitempty"`
+}
+
+// GetManualServers возвращает серверы, добавленные вручную.
+func (e *Engine) GetManualServers() ([]store.ServerNode, error) {
+	return e.store.GetManualServers()
+}
+
+// AddManualServer добавляет сервер из одной ссылки. Ссылка должна собираться в outbound sing-box.
+func (e *Engine) AddManualServer(req ManualServerRequest) (*store.ServerNode, error) {
+	node, err := manualServerNode(req)
+	if err != nil {
+		return nil, err
+	}
+	node.ID = manualIDPrefix + subscription.Fingerprint(node)
+	if err := e.checkDetour(node); err != nil {
+		return nil, err
+	}
+	if err := e.store.AddServer(node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// UpdateManualServer заменяет ссылку и/или имя ручного сервера; ID сохраняется,
+// чтобы не ломать ссылки на сервер в настройках.
+func (e *Engine) UpdateManualServer(id string, req ManualServerRequest) (*store.ServerNode, error) {
+	existing, err := e.findManualServer(id)
+	if err != nil {
+		return nil, err
+	}
+	sameSource := req.URI == "" && req.Outbound == nil
+	if sameSource {
+		req.URI, req.Outbound = existing.URI, existing.Outbound
+	}
+	if req.Name == "" && (sameSource || (req.URI != "" && req.URI == existing.URI)) {
+		req.Name = existing.Name
+	}
+	node, err := manualServerNode(req)
+	if err != nil {
+		return nil, err
+	}
+	node.ID = existing.ID
+	if err := e.checkDetour(node); err != nil {
+		return nil, err
+	}
+	if err := e.store.UpdateServer(node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// ErrServerInUse — сервер нельзя удалить: через него (detour) подключаются другие серверы.
+var ErrServerInUse = errors.New("server is in use")
+
+// DeleteManualServer удаляет ручной сервер; если подключены к нему — отключаемся.
+// Сервер, на который ссылается detour другого сервера, не удаляется, чтобы не рвать цепочки.
+func (e *Engine) DeleteManualServer(id string) error {
+	if _, err := e.findManualServer(id); err != nil {
+		return err
+	}
+	users, err := e.detourUsers(map[string]bool{id: true})
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("%w: detour of %s", ErrServerInUse, strings.Join(users, ", "))
+	}
+	if cur := e.GetCurrentServer(); cur != nil && cur.ID == id {
+		_ = e.Disconnect()
+	}
+	return e.store.DeleteServer(id)
+}
+
+func (e *Engine) findManualServer(id string) (*store.ServerNode, error) {
+	servers, err := e.store.GetManualServers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		if servers[i].ID == id {
+			return &servers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", store.ErrServerNotFound, id)
+}
+
+// detourUsers — имена серверов не из ids, у которых detour указывает на один из серверов ids.
+func (e *Engine) detourUsers(ids map[string]bool) ([]string, error) {
+	servers, err := e.store.GetServers()
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, n := range servers {
+		if detour, _ := n.Outbound["detour"].(string); ids[detour] && !ids[n.ID] {
+			users = append(users, n.Name)
+		}
+	}
+	return users, nil
+}
+
+// checkDetour заранее проверяет цепочку detour узла (сервер существует, нет цикла), чтобы ошибка
+// была видна при сохранении, а не при подключении.
+func (e *Engine) checkDetour(node store.ServerNode) error {
+	ob, err := serverOutbound(&node)
+	if err != nil {
+		return err
+	}
+	_, err = e.detourChain(ob, "detour", node.ID)
+	return err
+}
+
+// manualServerNode проверяет ссылку через outboundFromURI (сырой outbound — через serverOutbound)
+// и собирает узел (имя и страна — как у подписок).
+func manualServerNode(req ManualServerRequest) (store.ServerNode, error) {
+	uri := strings.TrimSpace(req.URI)
+	if req.Outbound != nil {
+		if uri != "" {
+			return store.ServerNode{}, fmt.Errorf("either uri or outbound expected, not both")
+		}
+		data, err := json.Marshal(req.Outbound)
+		if err != nil {
+			return store.ServerNode{}, err
+		}
+		uri = string(data)
+	}
+	if uri == "" {
+		return store.ServerNode{}, fmt.Errorf("uri required")
+	}
+	if strings.HasPrefix(uri, "{") {
+		return rawServerNode(uri, req.Name)
+	}
+	if strings.ContainsAny(uri, "\r\n") {
+		return store.ServerNode{}, fmt.Errorf("expected a single server link")
+	}
+	if _, err := outboundFromURI(uri); err != nil {
+		return store.ServerNode{}, fmt.Errorf("invalid server link: %w", err)
+	}
+	nodes, err := subscription.ParseContent(uri)
+	if err != nil {
+		return store.ServerNode{}, err
+	}
+	if len(nodes) != 1 {
+		return store.ServerNode{}, fmt.Errorf("expected a single server link")
+	}
+	return namedNode(nodes[0], req.Name), nil
+}
+
+// rawServerNode собирает узел из JSON одного outbound sing-box (тело запроса или вставленный в uri текст).
+func rawServerNode(content, name string) (store.ServerNode, error) {
+	nodes, err := subscription.ParseContent(content)
+	if err != nil {
+		return store.ServerNode{}, fmt.Errorf("invalid outbound: %w", err)
+	}
+	if len(nodes) != 1 || nodes[0].Outbound == nil {
+		return store.ServerNode{}, fmt.Errorf("expected a single sing-box outbound")
+	}
+	if _, err := serverOutbound(&nodes[0]); err != nil {
+		return store.ServerNode{}, fmt.Errorf("invalid outbound: %w", err)
+	}
+	return namedNode(nodes[0], name), nil
+}
+
+// namedNode задаёт узлу имя из запроса (если есть) и страну по нему.
+func namedNode(node store.ServerNode, name string) store.ServerNode {
+	if name := strings.TrimSpace(name); name != "" {
+		node.Name = name
+		if country := subscription.CountryFromName(name); country != "" {
+			node.Country = country
+		}
+	}
+	return node
+}
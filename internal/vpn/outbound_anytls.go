@@ -0,0 +1,42 @@
+package vpn
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// anytlsOutbound разбирает anytls://password@host:port?sni=..&insecure=1 (sing-box 1.12+).
+// Без TLS протокол не работает, поэтому security=none отклоняется.
+func anytlsOutbound(u *url.URL) (map[string]any, error) {
+	host, port, err := splitHostPort(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, fmt.Errorf("anytls: missing host")
+	}
+	if port == 0 {
+		port = 443
+	}
+	password := ""
+	if u.User != nil {
+		password = u.User.Username()
+	}
+	if password == "" {
+		return nil, fmt.Errorf("anytls: missing password")
+	}
+	tls, err := shareLinkTLS(u.Query(), "tls", host)
+	if err != nil {
+		return nil, fmt.Errorf("anytls: %w", err)
+	}
+	if tls == nil {
+		return nil, fmt.Errorf("anytls: tls is required")
+	}
+	return map[string]any{
+		"type":        "anytls",
+		"server":      host,
+		"server_port": port,
+		"password":    password,
+		"tls":         tls,
+	}, nil
+}
@@ -0,0 +1,185 @@
+package vpn
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// hysteria2Outbound разбирает hysteria2:// и hy2:// ссылки.
+// Формат: hysteria2://auth@host:port[,port-range]/?sni=..&insecure=1&obfs=salamander&obfs-password=..&mport=..&up=..&down=..
+// url.Parse не принимает диапазоны портов в authority, поэтому ссылка разбирается вручную.
+func hysteria2Outbound(raw string) (map[string]any, error) {
+	_, rest, ok := strings.Cut(strings.TrimSpace(raw), "://")
+	if !ok {
+		return nil, fmt.Errorf("hysteria2: invalid uri")
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	authority, rawQuery, _ := strings.Cut(rest, "?")
+	authority, _, _ = strings.Cut(authority, "/")
+
+	auth := ""
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		auth = authority[:at]
+		authority = authority[at+1:]
+		if decoded, err := url.PathUnescape(auth); err == nil {
+			auth = decoded
+		}
+	}
+
+	host, portSpec := splitHostPortSpec(authority)
+	if host == "" {
+		return nil, fmt.Errorf("hysteria2: missing host")
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("hysteria2: %w", err)
+	}
+	if auth == "" {
+		auth = q.Get("auth")
+	}
+
+	port, ranges, err := parsePortSpec(portSpec)
+	if err != nil {
+		return nil, fmt.Errorf("hysteria2: %w", err)
+	}
+	if mport := q.Get("mport"); mport != "" {
+		mainPort, extra, err := parsePortSpec(mport)
+		if err != nil {
+			return nil, fmt.Errorf("hysteria2: mport: %w", err)
+		}
+		if mainPort != 0 {
+			extra = append([]string{subscription.PortRange(mainPort)}, extra...)
+		}
+		ranges = append(ranges, extra...)
+	}
+	if port == 0 && len(ranges) > 0 {
+		// Только диапазон: sing-box всё равно требует server_port, берём начало первого диапазона.
+		first, _, _ := strings.Cut(ranges[0], ":")
+		port, _ = strconv.Atoi(first)
+	}
+	if port == 0 {
+		port = 443
+	}
+	ranges = subscription.Hysteria2ServerPorts(port, ranges)
+
+	out := map[string]any{
+		"type":        "hysteria2",
+		"server":      host,
+		"server_port": port,
+	}
+	if auth != "" {
+		out["password"] = auth
+	}
+	if len(ranges) > 0 {
+		out["server_ports"] = ranges
+		if hop := firstQuery(q, "hop_interval", "hopInterval", "hop-interval"); hop != "" {
+			if _, err := strconv.Atoi(hop); err == nil {
+				hop += "s"
+			}
+			out["hop_interval"] = hop
+		}
+	}
+	if up := parseMbps(firstQuery(q, "up", "upmbps", "up_mbps")); up > 0 {
+		out["up_mbps"] = up
+	}
+	if down := parseMbps(firstQuery(q, "down", "downmbps", "down_mbps")); down > 0 {
+		out["down_mbps"] = down
+	}
+
+	switch obfs := strings.ToLower(q.Get("obfs")); obfs {
+	case "", "none", "plain":
+	case "salamander":
+		out["obfs"] = map[string]any{
+			"type":     "salamander",
+			"password": q.Get("obfs-password"),
+		}
+	default:
+		return nil, fmt.Errorf("hysteria2: %w: obfs %s", subscription.ErrUnsupportedTransport, obfs)
+	}
+
+	tls := map[string]any{"enabled": true}
+	if sni := q.Get("sni"); sni != "" {
+		tls["server_name"] = sni
+	} else {
+		tls["server_name"] = host
+	}
+	if queryBool(q, "insecure", "allowInsecure") {
+		tls["insecure"] = true
+	}
+	if alpn := q.Get("alpn"); alpn != "" {
+		tls["alpn"] = strings.Split(alpn, ",")
+	}
+	// pinSHA256 — хеш всего сертификата; sing-box закрепляет только публичный ключ (certificate_public_key_sha256),
+	// поэтому параметр не переносится.
+	out["tls"] = tls
+	return out, nil
+}
+
+// splitHostPortSpec делит authority на хост и строку портов ("443", "443,20000-30000", "20000-30000").
+// Поддерживает IPv6 в квадратных скобках.
+func splitHostPortSpec(authority string) (string, string) {
+	if strings.HasPrefix(authority, "[") {
+		end := strings.Index(authority, "]")
+		if end < 0 {
+			return "", ""
+		}
+		host := authority[1:end]
+		return host, strings.TrimPrefix(authority[end+1:], ":")
+	}
+	host, ports, _ := strings.Cut(authority, ":")
+	return host, ports
+}
+
+// parsePortSpec разбирает список портов через запятую. Первый одиночный порт становится основным (0, если его нет),
+// диапазоны ("20000-30000") возвращаются в формате sing-box server_ports ("20000:30000").
+func parsePortSpec(spec string) (int, []string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, nil, nil
+	}
+	port := 0
+	var ranges []string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			from, to, isRange = strings.Cut(part, ":")
+		}
+		start, err := strconv.Atoi(from)
+		if err != nil || start <= 0 || start > 65535 {
+			return 0, nil, fmt.Errorf("invalid port: %s", part)
+		}
+		if !isRange {
+			if port == 0 {
+				port = start
+			} else {
+				ranges = append(ranges, subscription.PortRange(start))
+			}
+			continue
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil || end < start || end > 65535 {
+			return 0, nil, fmt.Errorf("invalid port range: %s", part)
+		}
+		ranges = append(ranges, fmt.Sprintf("%d:%d", start, end))
+	}
+	return port, ranges, nil
+}
+
+// parseMbps понимает "100", "100mbps", "100 Mbps". Пустая или нечисловая строка — 0.
+func parseMbps(s string) int {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimSuffix(s, "mbps")
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
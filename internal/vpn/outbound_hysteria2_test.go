@@ -0,0 +1,234 @@
+package vpn
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+func TestHysteria2Outbound(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		want map[string]any
+	}{
+		{
+			name: "userinfo password",
+			uri:  "hysteria2://secret@example.com:8443/?sni=cdn.example.com#node",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 8443, "password": "secret",
+				"tls": map[string]any{"enabled": true, "server_name": "cdn.example.com"},
+			},
+		},
+		{
+			name: "escaped userinfo",
+			uri:  "hy2://p%40ss%3Aword@example.com:443",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "p@ss:word",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "auth parameter",
+			uri:  "hy2://example.com?auth=from-query",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "from-query",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "userinfo wins over auth",
+			uri:  "hy2://user@example.com:443?auth=ignored",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "user",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "salamander obfs",
+			uri:  "hy2://pw@example.com:443?obfs=salamander&obfs-password=cry%20me",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"obfs": map[string]any{"type": "salamander", "password": "cry me"},
+				"tls":  map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "obfs none",
+			uri:  "hy2://pw@example.com:443?obfs=none",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "sni insecure alpn",
+			uri:  "hy2://pw@1.2.3.4:443?sni=real.example.com&insecure=1&alpn=h3,h3-29",
+			want: map[string]any{
+				"type": "hysteria2", "server": "1.2.3.4", "server_port": 443, "password": "pw",
+				"tls": map[string]any{
+					"enabled": true, "server_name": "real.example.com", "insecure": true,
+					"alpn": []string{"h3", "h3-29"},
+				},
+			},
+		},
+		{
+			name: "allowInsecure alias",
+			uri:  "hy2://pw@example.com:443?allowInsecure=true",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com", "insecure": true},
+			},
+		},
+		{
+			// sing-box не умеет закреплять хеш всего сертификата — параметр пропускается, а не роняет ссылку.
+			name: "pinSHA256 is ignored",
+			uri:  "hy2://pw@example.com:443?insecure=1&pinSHA256=ba:88:45:17:a1:1d",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com", "insecure": true},
+			},
+		},
+		{
+			name: "bandwidth",
+			uri:  "hy2://pw@example.com:443?up=50&down=200%20Mbps",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"up_mbps": 50, "down_mbps": 200,
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			// Основной порт остаётся в server_ports: при server_ports sing-box server_port не использует.
+			name: "port range in authority keeps main port",
+			uri:  "hy2://pw@example.com:443,20000-30000?hop_interval=30",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 443, "password": "pw",
+				"server_ports": []string{"443:443", "20000:30000"}, "hop_interval": "30s",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "mport keeps main port",
+			uri:  "hy2://pw@example.com:8443?mport=20000-30000,40000&hopInterval=1m",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 8443, "password": "pw",
+				"server_ports": []string{"8443:8443", "40000:40000", "20000:30000"}, "hop_interval": "1m",
+				"tls": map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "main port inside the hop range is not repeated",
+			uri:  "hy2://pw@example.com:25000?mport=20000-30000",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 25000, "password": "pw",
+				"server_ports": []string{"20000:30000"},
+				"tls":          map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "only range",
+			uri:  "hy2://pw@example.com:20000-30000",
+			want: map[string]any{
+				"type": "hysteria2", "server": "example.com", "server_port": 20000, "password": "pw",
+				"server_ports": []string{"20000:30000"},
+				"tls":          map[string]any{"enabled": true, "server_name": "example.com"},
+			},
+		},
+		{
+			name: "ipv6",
+			uri:  "hy2://pw@[2001:db8::1]:443",
+			want: map[string]any{
+				"type": "hysteria2", "server": "2001:db8::1", "server_port": 443, "password": "pw",
+				"tls": map[string]any{"enabled": true, "server_name": "2001:db8::1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hysteria2Outbound(tt.uri)
+			if err != nil {
+				t.Fatalf("hysteria2Outbound(%q): %v", tt.uri, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hysteria2Outbound(%q)\n got: %#v\nwant: %#v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHysteria2OutboundErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		is   error
+	}{
+		{name: "missing host", uri: "hy2://pw@:443"},
+		{name: "bad port", uri: "hy2://pw@example.com:70000"},
+		{name: "reversed range", uri: "hy2://pw@example.com:30000-20000"},
+		{name: "bad mport", uri: "hy2://pw@example.com:443?mport=abc"},
+		{name: "unknown obfs", uri: "hy2://pw@example.com:443?obfs=gfw", is: subscription.ErrUnsupportedTransport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := hysteria2Outbound(tt.uri)
+			if err == nil {
+				t.Fatalf("hysteria2Outbound(%q): expected error", tt.uri)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("hysteria2Outbound(%q): error %v is not %v", tt.uri, err, tt.is)
+			}
+		})
+	}
+}
+
+// Ссылка, собранная экспортом из outbound, разбирается обратно в тот же outbound (основной порт не дублируется в mport).
+func TestHysteria2ShareLinkRoundTrip(t *testing.T) {
+	for _, uri := range []string{
+		"hy2://pw@example.com:443,20000-30000?obfs=salamander&obfs-password=x&sni=a.example.com&insecure=1",
+		"hy2://pw@example.com:8443?mport=20000-30000&hop_interval=30&up=10&down=100",
+		"hy2://pw@example.com:20000-30000",
+	} {
+		ob, err := hysteria2Outbound(uri)
+		if err != nil {
+			t.Fatalf("hysteria2Outbound(%q): %v", uri, err)
+		}
+		link, err := subscription.OutboundToURI("node", ob)
+		if err != nil {
+			t.Fatalf("OutboundToURI(%v): %v", ob, err)
+		}
+		again, err := hysteria2Outbound(link)
+		if err != nil {
+			t.Fatalf("hysteria2Outbound(%q): %v", link, err)
+		}
+		if !reflect.DeepEqual(again, ob) {
+			t.Errorf("round trip of %q via %q\n got: %#v\nwant: %#v", uri, link, again, ob)
+		}
+	}
+}
+
+// Порт-хоппинг переживает экспорт в Clash и обратный импорт: основной порт остаётся в server_ports.
+func TestHysteria2ClashRoundTrip(t *testing.T) {
+	ob, err := outboundFromURI("hy2://secret@example.com:443?mport=20000-30000#hop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := subscription.OutboundToClash("hop", ob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := subscription.EncodeClash([]map[string]any{proxy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := subscription.ParseContent(string(body))
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("ParseContent: %d nodes, %v\n%s", len(nodes), err, body)
+	}
+	want := []string{"443:443", "20000:30000"}
+	if got := nodes[0].Outbound["server_ports"]; !reflect.DeepEqual(got, want) || !reflect.DeepEqual(ob["server_ports"], want) {
+		t.Errorf("server_ports: link %v, after clash %v; want %v", ob["server_ports"], got, want)
+	}
+}
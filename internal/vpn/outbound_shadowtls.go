@@ -0,0 +1,78 @@
+package vpn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// shadowTLSOptions — параметры ShadowTLS, поверх которого идёт shadowsocks.
+// host — сайт, под рукопожатие с которым маскируется соединение (SNI).
+type shadowTLSOptions struct {
+	Version  string `json:"version"`
+	Host     string `json:"host"`
+	Password string `json:"password"`
+}
+
+// shadowTLSFromPlugin разбирает опции SIP003-плагина "shadow-tls;host=cloud.tencent.com;password=..;version=3" (как в Clash).
+func shadowTLSFromPlugin(opts string) shadowTLSOptions {
+	var o shadowTLSOptions
+	for _, kv := range strings.Split(opts, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		switch key {
+		case "host":
+			o.Host = value
+		case "password":
+			o.Password = value
+		case "version":
+			o.Version = value
+		}
+	}
+	return o
+}
+
+// shadowTLSFromParam разбирает параметр shadow-tls=BASE64(JSON) из ссылок Shadowrocket.
+func shadowTLSFromParam(raw string) (shadowTLSOptions, error) {
+	var o shadowTLSOptions
+	decoded, err := decodeBase64Compat(unescapePlus(raw))
+	if err != nil {
+		return o, fmt.Errorf("shadowtls: invalid shadow-tls parameter: %w", err)
+	}
+	var fields map[string]vmessField
+	if err := json.Unmarshal(decoded, &fields); err != nil {
+		return o, fmt.Errorf("shadowtls: invalid shadow-tls parameter: %w", err)
+	}
+	o.Version, o.Host, o.Password = string(fields["version"]), string(fields["host"]), string(fields["password"])
+	return o, nil
+}
+
+// shadowTLSOutbound собирает shadowtls outbound на адресе узла. Версия по умолчанию — 2, как в Clash.
+func shadowTLSOutbound(server string, port int, o shadowTLSOptions) (map[string]any, error) {
+	version := 2
+	switch o.Version {
+	case "", "2":
+	case "1":
+		version = 1
+	case "3":
+		version = 3
+	default:
+		return nil, fmt.Errorf("shadowtls: unsupported version: %s", o.Version)
+	}
+	if o.Host == "" {
+		return nil, fmt.Errorf("shadowtls: missing host")
+	}
+	out := map[string]any{
+		"type":        "shadowtls",
+		"server":      server,
+		"server_port": port,
+		"version":     version,
+		"tls":         map[string]any{"enabled": true, "server_name": o.Host},
+	}
+	if version > 1 {
+		if o.Password == "" {
+			return nil, fmt.Errorf("shadowtls: missing password")
+		}
+		out["password"] = o.Password
+	}
+	return out, nil
+}
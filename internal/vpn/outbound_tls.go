@@ -0,0 +1,159 @@
+package vpn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// UTLSFingerprintNone в Settings.UTLSFingerprint отключает отпечаток по умолчанию.
+const UTLSFingerprintNone = "none"
+
+// utlsFingerprints — отпечатки uTLS, которые понимает sing-box.
+var utlsFingerprints = map[string]bool{
+	"chrome": true, "firefox": true, "edge": true, "safari": true, "360": true,
+	"qq": true, "ios": true, "android": true, "random": true, "randomized": true,
+}
+
+// ValidUTLSFingerprint — можно ли сохранить значение в Settings.UTLSFingerprint.
+func ValidUTLSFingerprint(fp string) bool {
+	return fp == UTLSFingerprintNone || utlsFingerprints[fp]
+}
+
+// shareLinkTLS собирает sing-box tls из параметров vless/trojan ссылки.
+// Без security берётся defaultSecurity (у vless TLS нет, у trojan есть); при security=none
+// TLS выключен, даже если в ссылке остался sni. Возвращает nil, если TLS не нужен.
+func shareLinkTLS(q url.Values, defaultSecurity, server string) (map[string]any, error) {
+	security := strings.ToLower(q.Get("security"))
+	if security == "" {
+		security = defaultSecurity
+	}
+	switch security {
+	case "none":
+		return nil, nil
+	case "tls", "xtls", "reality":
+	default:
+		return nil, fmt.Errorf("%w: security %s", subscription.ErrUnsupportedTransport, security)
+	}
+
+	tls := map[string]any{"enabled": true}
+	if sni := linkServerName(q, server); sni != "" {
+		tls["server_name"] = sni
+	}
+	if alpn := subscription.SplitList(q.Get("alpn")); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if queryBool(q, "allowInsecure", "insecure", "allow_insecure") {
+		tls["insecure"] = true
+	}
+	// Незнакомый sing-box отпечаток (например, randomizednoalpn из Xray) не даст ему запуститься,
+	// поэтому такой fp отбрасываем — сработает отпечаток по умолчанию.
+	if fp := strings.ToLower(q.Get("fp")); utlsFingerprints[fp] {
+		tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+	}
+	if ech := q.Get("ech"); ech != "" {
+		tls["ech"] = echOptions(ech)
+	}
+	if pcs := q.Get("pcs"); pcs != "" {
+		pins, err := publicKeyPins(pcs)
+		if err != nil {
+			return nil, err
+		}
+		tls["certificate_public_key_sha256"] = pins
+	}
+
+	if security == "reality" {
+		pbk := q.Get("pbk")
+		if pbk == "" {
+			return nil, fmt.Errorf("reality: missing pbk")
+		}
+		reality := map[string]any{"enabled": true, "public_key": pbk}
+		if sid := q.Get("sid"); sid != "" {
+			reality["short_id"] = sid
+		}
+		// spx (SpiderX) в sing-box нет: клиент Xray лишь ходит по этому пути при ошибке рукопожатия.
+		tls["reality"] = reality
+	}
+	return tls, nil
+}
+
+// linkServerName — SNI ссылки: sni (peer у trojan-go), затем первый host транспорта, затем адрес сервера.
+func linkServerName(q url.Values, server string) string {
+	if sni := firstQuery(q, "sni", "peer"); sni != "" {
+		return sni
+	}
+	if host := firstListItem(q.Get("host")); host != "" {
+		return host
+	}
+	return server
+}
+
+// echOptions — ech из ссылки: ECHConfigList в base64 кладём в конфиг как PEM, иначе
+// (например, Xray-формат «домен+DNS-сервер») sing-box сам запросит конфиг из HTTPS-записи DNS.
+func echOptions(value string) map[string]any {
+	ech := map[string]any{"enabled": true}
+	if raw, err := decodeBase64Compat(unescapePlus(value)); err == nil && isECHConfigList(raw) {
+		ech["config"] = []string{
+			"-----BEGIN ECH CONFIGS-----",
+			base64.StdEncoding.EncodeToString(raw),
+			"-----END ECH CONFIGS-----",
+		}
+	}
+	return ech
+}
+
+// isECHConfigList — первые два байта ECHConfigList равны длине остального списка.
+func isECHConfigList(raw []byte) bool {
+	return len(raw) > 2 && int(raw[0])<<8|int(raw[1]) == len(raw)-2
+}
+
+// publicKeyPins разбирает pcs. sing-box умеет закреплять только SHA-256 публичного ключа (base64);
+// hex-хеш всего сертификата, как в Xray, ему не выразить — такой узел лучше отвергнуть, чем молча не проверять.
+func publicKeyPins(pcs string) ([]string, error) {
+	var pins []string
+	for _, pin := range subscription.SplitList(pcs) {
+		pin = unescapePlus(pin)
+		raw, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("pcs: only base64 sha256 of the certificate public key is supported by sing-box: %s", pin)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// unescapePlus возвращает '+' в base64, который ссылка не экранировала и query превратил в пробелы.
+func unescapePlus(s string) string {
+	return strings.ReplaceAll(s, " ", "+")
+}
+
+// applyDefaultFingerprint включает uTLS с отпечатком из настроек там, где ссылка его не задала.
+// Reality без uTLS не работает, поэтому для неё по умолчанию chrome, даже если отпечаток в настройках отключён.
+// QUIC-протоколы (hysteria2, tuic) и naive (свой стек Chromium) uTLS не поддерживают и не трогаются.
+func applyDefaultFingerprint(ob map[string]any, fp string) {
+	if detour, ok := ob["detour"].(map[string]any); ok {
+		applyDefaultFingerprint(detour, fp)
+	}
+	switch ob["type"] {
+	case "vless", "vmess", "trojan", "anytls", "shadowtls":
+	default:
+		return
+	}
+	tls, _ := ob["tls"].(map[string]any)
+	if tls == nil || tls["enabled"] != true || tls["utls"] != nil {
+		return
+	}
+	if t, _ := ob["transport"].(map[string]any); t != nil && t["type"] == "quic" {
+		return
+	}
+	if !utlsFingerprints[fp] {
+		if tls["reality"] == nil {
+			return
+		}
+		fp = "chrome"
+	}
+	tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+}
@@ -0,0 +1,202 @@
+package vpn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// vmessField — значение из vmess JSON: генераторы пишут port, aid и флаги то строкой, то числом или bool.
+type vmessField string
+
+func (f *vmessField) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*f = vmessField(strings.TrimSpace(s))
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v != nil {
+		*f = vmessField(fmt.Sprint(v))
+	}
+	return nil
+}
+
+// vmessLink — JSON из vmess:// ссылки (схема v2rayN v2). packet_encoding, global_padding и
+// authenticated_length в v2rayN нет — их добавляют генераторы, ориентированные на sing-box.
+type vmessLink struct {
+	PS                  vmessField `json:"ps"`
+	Add                 vmessField `json:"add"`
+	Port                vmessField `json:"port"`
+	ID                  vmessField `json:"id"`
+	Aid                 vmessField `json:"aid"`
+	Scy                 vmessField `json:"scy"`
+	Net                 vmessField `json:"net"`
+	Type                vmessField `json:"type"`
+	Host                vmessField `json:"host"`
+	Path                vmessField `json:"path"`
+	TLS                 vmessField `json:"tls"`
+	SNI                 vmessField `json:"sni"`
+	ALPN                vmessField `json:"alpn"`
+	FP                  vmessField `json:"fp"`
+	AllowInsecure       vmessField `json:"allowInsecure"`
+	PacketEncoding      vmessField `json:"packet_encoding"`
+	GlobalPadding       vmessField `json:"global_padding"`
+	AuthenticatedLength vmessField `json:"authenticated_length"`
+}
+
+// vmessCiphers — значения scy, которые понимает sing-box.
+var vmessCiphers = map[string]bool{
+	"auto": true, "none": true, "zero": true,
+	"aes-128-gcm": true, "chacha20-poly1305": true, "aes-128-ctr": true,
+}
+
+// vmessOutbound разбирает vmess://BASE64(JSON) в sing-box vmess outbound.
+func vmessOutbound(raw string) (map[string]any, error) {
+	payload := strings.TrimPrefix(strings.TrimSpace(raw), "vmess://")
+	decoded, err := decodeBase64Compat(payload)
+	if err != nil {
+		return nil, err
+	}
+	var v vmessLink
+	if err := json.Unmarshal(decoded, &v); err != nil {
+		return nil, err
+	}
+	if v.Add == "" || v.ID == "" || v.Port == "" {
+		return nil, fmt.Errorf("vmess: missing add/id/port")
+	}
+	port, err := strconv.Atoi(string(v.Port))
+	if err != nil {
+		return nil, fmt.Errorf("vmess: invalid port: %s", v.Port)
+	}
+
+	security := strings.ToLower(string(v.Scy))
+	if security == "" {
+		security = "auto"
+	}
+	if !vmessCiphers[security] {
+		return nil, fmt.Errorf("vmess: unsupported cipher: %s", v.Scy)
+	}
+	out := map[string]any{
+		"type":        "vmess",
+		"server":      string(v.Add),
+		"server_port": port,
+		"uuid":        string(v.ID),
+		"security":    security,
+		"alter_id":    0,
+	}
+	if v.Aid != "" {
+		if aid, err := strconv.Atoi(string(v.Aid)); err == nil {
+			out["alter_id"] = aid
+		}
+	}
+	switch pe := strings.ToLower(string(v.PacketEncoding)); pe {
+	case "", "none":
+	case "packetaddr", "xudp":
+		out["packet_encoding"] = pe
+	default:
+		return nil, fmt.Errorf("vmess: unsupported packet_encoding: %s", v.PacketEncoding)
+	}
+	if vmessBool(v.GlobalPadding) {
+		out["global_padding"] = true
+	}
+	if vmessBool(v.AuthenticatedLength) {
+		out["authenticated_length"] = true
+	}
+
+	switch tls := strings.ToLower(string(v.TLS)); tls {
+	case "", "none":
+	case "tls":
+		out["tls"] = vmessTLS(v)
+	default:
+		return nil, fmt.Errorf("vmess: %w: security %s", subscription.ErrUnsupportedTransport, v.TLS)
+	}
+
+	transport, err := vmessTransport(v)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		out["transport"] = transport
+		// QUIC без TLS не бывает: v2ray включает его неявно, sing-box требует явно.
+		if transport["type"] == "quic" && out["tls"] == nil {
+			out["tls"] = vmessTLS(v)
+		}
+	}
+	if err := finishTransport(out, string(v.Add)); err != nil {
+		return nil, fmt.Errorf("vmess: %w", err)
+	}
+	return out, nil
+}
+
+func vmessTLS(v vmessLink) map[string]any {
+	tls := map[string]any{"enabled": true}
+	serverName := string(v.SNI)
+	// У quic в host лежит quicSecurity, а не имя сервера.
+	if serverName == "" && !strings.EqualFold(string(v.Net), "quic") {
+		serverName = firstListItem(string(v.Host))
+	}
+	if serverName == "" {
+		serverName = string(v.Add)
+	}
+	tls["server_name"] = serverName
+	if alpn := subscription.SplitList(string(v.ALPN)); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if vmessBool(v.AllowInsecure) {
+		tls["insecure"] = true
+	}
+	// Как и в shareLinkTLS, незнакомый sing-box отпечаток отбрасываем.
+	if fp := strings.ToLower(string(v.FP)); utlsFingerprints[fp] {
+		tls["utls"] = map[string]any{
+			"enabled":     true,
+			"fingerprint": fp,
+		}
+	}
+	return tls
+}
+
+// vmessTransport переводит поля v2rayN в параметры share-ссылки и собирает транспорт через v2rayTransport.
+// В v2rayN для grpc в path лежит serviceName, для quic в host — quicSecurity, а type — маскировка заголовков.
+func vmessTransport(v vmessLink) (map[string]any, error) {
+	network := strings.ToLower(string(v.Net))
+	q := url.Values{}
+	if v.Path != "" {
+		q.Set("path", string(v.Path))
+		q.Set("serviceName", string(v.Path))
+	}
+	if v.Host != "" {
+		key := "host"
+		if network == "quic" {
+			key = "quicSecurity"
+		}
+		q.Set(key, string(v.Host))
+	}
+	if v.Type != "" {
+		q.Set("headerType", string(v.Type))
+	}
+	transport, err := v2rayTransport(network, q)
+	if err != nil {
+		return nil, fmt.Errorf("vmess: %w", err)
+	}
+	return transport, nil
+}
+
+func vmessBool(f vmessField) bool {
+	b, _ := strconv.ParseBool(string(f))
+	return b
+}
+
+func firstListItem(s string) string {
+	if list := subscription.SplitList(s); len(list) > 0 {
+		return list[0]
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package vpn
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestVmessOutboundGolden: testdata/vmess/<case>.input.json — JSON из vmess:// ссылки (v2rayN),
+// <case>.golden.json — ожидаемый outbound. go test -run VmessOutboundGolden -update переписывает эталоны.
+func TestVmessOutboundGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "vmess", "*.input.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no vmess fixtures")
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input.json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			link := "vmess://" + base64.StdEncoding.EncodeToString(bytes.TrimSpace(raw))
+			ob, err := vmessOutbound(link)
+			if err != nil {
+				t.Fatalf("vmessOutbound: %v", err)
+			}
+			got, err := json.MarshalIndent(ob, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+			golden := filepath.Join("testdata", "vmess", name+".golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("outbound differs from %s\n got: %s\nwant: %s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestVmessOutboundErrors(t *testing.T) {
+	for name, fields := range map[string]string{
+		"missing port":     `{"add":"vm.example.com","id":"b831381d-6324-4d53-ad4f-8cda48b30811"}`,
+		"bad port":         `{"add":"vm.example.com","port":"https","id":"b831381d-6324-4d53-ad4f-8cda48b30811"}`,
+		"unknown cipher":   `{"add":"vm.example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811","scy":"rc4"}`,
+		"unknown security": `{"add":"vm.example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811","tls":"xtls"}`,
+		"bad packet_encoding": `{"add":"vm.example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811",` +
+			`"packet_encoding":"udp-over-tcp"}`,
+		"unsupported network": `{"add":"vm.example.com","port":"443","id":"b831381d-6324-4d53-ad4f-8cda48b30811","net":"kcp"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			link := "vmess://" + base64.StdEncoding.EncodeToString([]byte(fields))
+			if _, err := vmessOutbound(link); err == nil {
+				t.Errorf("vmessOutbound(%s): expected error", fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package vpn
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// wireguardEndpoint разбирает wireguard:// (и wg://) ссылку в sing-box endpoint типа wireguard.
+// Формат: wireguard://PRIVATE_KEY@host:port?publickey=..&address=10.0.0.2/32,fd00::2/128&presharedkey=..&mtu=1420&reserved=1,2,3&allowedips=..&keepalive=25
+// Ключи в base64 часто содержат '/', поэтому ссылка разбирается вручную, а не через url.Parse.
+// Начиная с sing-box 1.11 WireGuard — это endpoint, а не outbound: см. isEndpointType.
+func wireguardEndpoint(raw string) (map[string]any, error) {
+	_, rest, ok := strings.Cut(strings.TrimSpace(raw), "://")
+	if !ok {
+		return nil, fmt.Errorf("wireguard: invalid uri")
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	authority, rawQuery, _ := strings.Cut(rest, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard: %w", err)
+	}
+
+	privateKey := ""
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		privateKey = authority[:at]
+		authority = authority[at+1:]
+		if decoded, err := url.PathUnescape(privateKey); err == nil {
+			privateKey = decoded
+		}
+	}
+	if privateKey == "" {
+		privateKey = firstQuery(q, "privatekey", "private_key", "privateKey")
+	}
+	if privateKey == "" {
+		return nil, fmt.Errorf("wireguard: missing private key")
+	}
+
+	host, port, err := splitHostPort(strings.TrimSuffix(authority, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("wireguard: %w", err)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("wireguard: missing host")
+	}
+	if port == 0 {
+		port = 51820
+	}
+
+	publicKey := firstQuery(q, "publickey", "public_key", "publicKey", "peer_public_key")
+	if publicKey == "" {
+		return nil, fmt.Errorf("wireguard: missing peer public key")
+	}
+	addresses := subscription.WireGuardAddresses(firstQuery(q, "address", "ip", "local_address"))
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("wireguard: missing interface address")
+	}
+
+	allowedIPs := subscription.SplitList(firstQuery(q, "allowedips", "allowed_ips", "allowedIPs"))
+	if len(allowedIPs) == 0 {
+		allowedIPs = []string{"0.0.0.0/0", "::/0"}
+	}
+	peer := map[string]any{
+		"address":     host,
+		"port":        port,
+		"public_key":  publicKey,
+		"allowed_ips": allowedIPs,
+	}
+	if psk := firstQuery(q, "presharedkey", "pre_shared_key", "preSharedKey", "psk"); psk != "" {
+		peer["pre_shared_key"] = psk
+	}
+	if ka := firstQuery(q, "keepalive", "persistent_keepalive", "persistentKeepalive"); ka != "" {
+		n, err := strconv.Atoi(ka)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("wireguard: invalid keepalive: %s", ka)
+		}
+		if n > 0 {
+			peer["persistent_keepalive_interval"] = n
+		}
+	}
+	if r := q.Get("reserved"); r != "" {
+		reserved, err := subscription.WireGuardReserved(r)
+		if err != nil {
+			return nil, fmt.Errorf("wireguard: %w", err)
+		}
+		peer["reserved"] = reserved
+	}
+
+	out := map[string]any{
+		"type":        "wireguard",
+		"address":     addresses,
+		"private_key": privateKey,
+		"peers":       []any{peer},
+	}
+	if mtu := q.Get("mtu"); mtu != "" {
+		n, err := strconv.Atoi(mtu)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("wireguard: invalid mtu: %s", mtu)
+		}
+		out["mtu"] = n
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package vpn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/GalitskyKK/nekkus-net/internal/store"
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
+)
+
+// Форматы GET /api/subscriptions/{id}/export.
+const (
+	ExportURI     = "uri"
+	ExportBase64  = "base64"
+	ExportClash   = "clash"
+	ExportSingBox = "singbox"
+)
+
+// qrSize — сторона PNG с QR-кодом в пикселях.
+const qrSize = 512
+
+// ServerShare — ссылка на сервер для переноса на другое устройство.
+type ServerShare struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+	// QR — PNG с QR-кодом ссылки в виде data URL.
+	QR string `json:"qr"`
+}
+
+// ShareServer возвращает каноническую ссылку на сервер и её QR-код.
+func (e *Engine) ShareServer(id string) (*ServerShare, error) {
+	server, err := e.store.GetServer(id)
+	if err != nil {
+		return nil, err
+	}
+	uri, err := serverShareURI(server)
+	if err != nil {
+		return nil, err
+	}
+	png, err := ServerQRCode(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerShare{
+		ID:   server.ID,
+		Name: server.Name,
+		URI:  uri,
+		QR:   "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ServerQRCode рисует QR-код ссылки в PNG.
+func ServerQRCode(uri string) ([]byte, error) {
+	return qrcode.Encode(uri, qrcode.Medium, qrSize)
+}
+
+// ExportSkip — узел, не попавший в экспорт, и почему (формат его не выражает или он подключается через другой сервер).
+type ExportSkip struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ExportSubscription собирает серверы подписки в выбранном формате; возвращает тело, Content-Type
+// и узлы, которые пришлось пропустить: их нельзя выразить в формате, не подключаясь к серверу иначе.
+func (e *Engine) ExportSubscription(id, format string) ([]byte, string, []ExportSkip, error) {
+	sub, err := e.store.GetSubscription(id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var skipped []ExportSkip
+	skip := func(n *store.ServerNode, err error) {
+		skipped = append(skipped, ExportSkip{ID: n.ID, Name: n.Name, Reason: err.Error()})
+	}
+	switch format {
+	case "", ExportURI, ExportBase64:
+		uris := make([]string, 0, len(sub.Servers))
+		for i := range sub.Servers {
+			uri, err := serverShareURI(&sub.Servers[i])
+			if err != nil {
+				skip(&sub.Servers[i], err)
+				continue
+			}
+			uris = append(uris, uri)
+		}
+		if format == ExportBase64 {
+			return []byte(subscription.EncodeBase64(uris)), "text/plain; charset=utf-8", skipped, nil
+		}
+		return []byte(subscription.EncodeURIList(uris)), "text/plain; charset=utf-8", skipped, nil
+	case ExportClash:
+		proxies := make([]map[string]any, 0, len(sub.Servers))
+		for i := range sub.Servers {
+			ob, err := e.outboundFor(&sub.Servers[i])
+			if err != nil {
+				skip(&sub.Servers[i], err)
+				continue
+			}
+			p, err := subscription.OutboundToClash(sub.Servers[i].Name, ob)
+			if err != nil {
+				skip(&sub.Servers[i], err)
+				continue
+			}
+			proxies = append(proxies, p)
+		}
+		body, err := subscription.EncodeClash(proxies)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return body, "application/yaml; charset=utf-8", skipped, nil
+	case ExportSingBox:
+		cfg := struct {
+			Outbounds []map[string]any `json:"outbounds"`
+			Endpoints []map[string]any `json:"endpoints,omitempty"`
+		}{Outbounds: []map[string]any{}}
+		for i := range sub.Servers {
+			ob, err := e.outboundFor(&sub.Servers[i])
+			if err != nil {
+				skip(&sub.Servers[i], err)
+				continue
+			}
+			ob["tag"] = sub.Servers[i].Name
+			// В конфиге sing-box цепочка выражается: серверы, через которые идёт узел, выгружаются вместе с ним.
+			chain, err := e.detourChain(ob, sub.Servers[i].Name+" detour", sub.Servers[i].ID)
+			if err != nil {
+				skip(&sub.Servers[i], err)
+				continue
+			}
+			for _, o := range append([]map[string]any{ob}, chain...) {
+				if isEndpointType(o["type"]) {
+					cfg.Endpoints = append(cfg.Endpoints, o)
+				} else {
+					cfg.Outbounds = append(cfg.Outbounds, o)
+				}
+			}
+		}
+		body, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return body, "application/json", skipped, nil
+	default:
+		return nil, "", nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+// serverShareURI перекодирует outbound узла в ссылку; если формат ссылки его не выражает,
+// а исходная ссылка есть — отдаём её. Узел в цепочке серверов ссылкой не передать: исходная ссылка
+// описывала бы прямое подключение.
+func serverShareURI(server *store.ServerNode) (string, error) {
+	ob, err := serverOutbound(server)
+	if err != nil {
+		return "", err
+	}
+	uri, err := subscription.OutboundToURI(server.Name, ob)
+	if err != nil && server.URI != "" && !errors.Is(err, subscription.ErrDetourChain) {
+		return server.URI, nil
+	}
+	return uri, err
+}
@@ -10,12 +10,14 @@ import (
 	"strings"
 
 	"github.com/GalitskyKK/nekkus-net/internal/store"
+	"github.com/GalitskyKK/nekkus-net/internal/subscription"
 )
 
 type singBoxConfig struct {
 	Log      map[string]any   `json:"log,omitempty"`
 	Inbounds []map[string]any `json:"inbounds"`
 	Outbounds []map[string]any `json:"outbounds"`
+	Endpoints []map[string]any `json:"endpoints,omitempty"`
 	Route    map[string]any   `json:"route,omitempty"`
 }
 
@@ -25,15 +27,19 @@ func (e *Engine) generateSingboxConfig(server *store.ServerNode) (string, error)
 		"type":             "mixed",
 		"tag":              "mixed-in",
 		"listen":           "127.0.0.1",
-		"listen_port":      7890,
+		"listen_port":      proxyPort,
 		"set_system_proxy": true,
 	}
 
-	outbound, err := outboundFromURI(server.URI)
+	outbound, err := e.outboundFor(server)
 	if err != nil {
 		return "", fmt.Errorf("unsupported/invalid server URI (refresh subscription?): %w", err)
 	}
 	outbound["tag"] = "proxy"
+	chain, err := e.detourChain(outbound, "proxy-detour", server.ID)
+	if err != nil {
+		return "", err
+	}
 
 	cfg := singBoxConfig{
 		Log: map[string]any{
@@ -41,7 +47,6 @@ func (e *Engine) generateSingboxConfig(server *store.ServerNode) (string, error)
 		},
 		Inbounds: []map[string]any{inbound},
 		Outbounds: []map[string]any{
-			outbound,
 			{"type": "direct", "tag": "direct"},
 			{"type": "block", "tag": "block"},
 		},
@@ -49,6 +54,15 @@ func (e *Engine) generateSingboxConfig(server *store.ServerNode) (string, error)
 			"final": "proxy",
 		},
 	}
+	var proxies []map[string]any
+	for _, ob := range append([]map[string]any{outbound}, chain...) {
+		if isEndpointType(ob["type"]) {
+			cfg.Endpoints = append(cfg.Endpoints, ob)
+		} else {
+			proxies = append(proxies, ob)
+		}
+	}
+	cfg.Outbounds = append(proxies, cfg.Outbounds...)
 
 	encoded, err := json.Marshal(cfg)
 	if err != nil {
@@ -57,8 +71,154 @@ func (e *Engine) generateSingboxConfig(server *store.ServerNode) (string, error)
 	return string(encoded), nil
 }
 
-// IsURISupported возвращает true, если URI поддерживается sing-box (vmess, vless, trojan, ss с транспортами tcp/ws/grpc).
-// Используется для фильтрации списка серверов в UI (например, xhttp и др. не показываем).
+// isEndpointType — типы, которые в sing-box 1.11+ описываются в "endpoints", а не в "outbounds".
+// На endpoint можно ссылаться по tag так же, как на outbound (route.final = "proxy").
+func isEndpointType(t any) bool {
+	return t == "wireguard"
+}
+
+// splitDetour выносит вложенный outbound, через который подключается узел (ShadowTLS под shadowsocks).
+// В узле он хранится прямо в поле detour, чтобы узел оставался одним outbound; в конфиг sing-box
+// он попадает отдельно с тегом tag, а detour узла становится ссылкой на этот тег. Нет вложенного — nil.
+func splitDetour(ob map[string]any, tag string) map[string]any {
+	detour, ok := ob["detour"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	detour["tag"] = tag
+	ob["detour"] = tag
+	return detour
+}
+
+// maxDetourChain — сколько серверов может стоять перед узлом в цепочке detour.
+const maxDetourChain = 8
+
+// detourChain разворачивает detour узла в outbound-ы, через которые он подключается, по порядку.
+// detour — вложенный outbound (ShadowTLS) или ID другого сохранённого сервера (ручного или из подписки),
+// у которого может быть свой detour. Ссылки заменяются тегами tagPrefix-1, tagPrefix-2…;
+// циклы (в том числе обратно на сам узел selfID) отвергаются.
+func (e *Engine) detourChain(ob map[string]any, tagPrefix, selfID string) ([]map[string]any, error) {
+	var chain []map[string]any
+	seen := map[string]bool{selfID: selfID != ""}
+	for cur := ob; ; {
+		tag := tagPrefix + "-" + strconv.Itoa(len(chain)+1)
+		if nested := splitDetour(cur, tag); nested != nil {
+			chain = append(chain, nested)
+			cur = nested
+			continue
+		}
+		id, _ := cur["detour"].(string)
+		if id == "" {
+			return chain, nil
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("detour: cycle through server %s", id)
+		}
+		if len(chain) >= maxDetourChain {
+			return nil, fmt.Errorf("detour: chain is longer than %d servers", maxDetourChain)
+		}
+		seen[id] = true
+		server, err := e.store.GetServer(id)
+		if err != nil {
+			return nil, fmt.Errorf("detour: %w", err)
+		}
+		next, err := e.outboundFor(server)
+		if err != nil {
+			return nil, fmt.Errorf("detour %s: %w", id, err)
+		}
+		next["tag"] = tag
+		cur["detour"] = tag
+		chain = append(chain, next)
+		cur = next
+	}
+}
+
+// serverOutbound возвращает sing-box outbound узла: готовый (ServerNode.Outbound) или собранный из URI.
+// Готовый outbound копируется как есть, чтобы замена tag на "proxy" не меняла данные из store.
+func serverOutbound(server *store.ServerNode) (map[string]any, error) {
+	if server.Outbound != nil {
+		return cloneOutbound(server.Outbound)
+	}
+	return outboundFromURI(server.URI)
+}
+
+// outboundFor — outbound узла для запуска и экспорта в конфиги: serverOutbound плюс uTLS-отпечаток
+// по умолчанию из настроек (Settings.UTLSFingerprint).
+func (e *Engine) outboundFor(server *store.ServerNode) (map[string]any, error) {
+	ob, err := serverOutbound(server)
+	if err != nil {
+		return nil, err
+	}
+	settings, _ := e.store.GetSettings()
+	applyDefaultFingerprint(ob, settings.UTLSFingerprint)
+	return ob, nil
+}
+
+// proxyOutboundTypes — типы outbound sing-box, которые могут быть сервером узла
+// (служебные direct, block, selector и т.п. — нет).
+var proxyOutboundTypes = map[string]bool{
+	"vless": true, "vmess": true, "trojan": true, "shadowsocks": true, "shadowtls": true,
+	"hysteria": true, "hysteria2": true, "tuic": true, "wireguard": true,
+	"socks": true, "http": true, "naive": true, "anytls": true, "ssh": true, "tor": true,
+}
+
+func cloneOutbound(src map[string]any) (map[string]any, error) {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	t, _ := out["type"].(string)
+	if t == "" {
+		return nil, fmt.Errorf("outbound: missing type")
+	}
+	if !proxyOutboundTypes[t] {
+		return nil, fmt.Errorf("%w: outbound type %s", subscription.ErrUnsupportedScheme, t)
+	}
+	return out, nil
+}
+
+// IsServerSupported — можно ли собрать outbound для узла (см. IsURISupported).
+func IsServerSupported(server store.ServerNode) bool {
+	return ValidateServer(server) == nil
+}
+
+// ValidateServer объясняет, почему для узла нельзя собрать outbound (nil — можно).
+// Неизвестные схемы и транспорты оборачивают subscription.ErrUnsupportedScheme/ErrUnsupportedTransport.
+func ValidateServer(server store.ServerNode) error {
+	_, err := serverOutbound(&server)
+	return err
+}
+
+// CheckServer — ValidateServer для отчёта о разборе подписки: для рабочего узла вдобавок
+// перечисляет, что из его ссылки не попадёт в outbound (см. ServerWarnings).
+func CheckServer(server store.ServerNode) ([]string, error) {
+	if err := ValidateServer(server); err != nil {
+		return nil, err
+	}
+	return ServerWarnings(server), nil
+}
+
+// ServerWarnings — пропущенные при сборке outbound параметры ссылки узла (пока только неизвестные параметры tuic://).
+func ServerWarnings(server store.ServerNode) []string {
+	if server.Outbound != nil {
+		return nil
+	}
+	u, err := url.Parse(strings.TrimSpace(server.URI))
+	if err != nil || !strings.EqualFold(u.Scheme, "tuic") {
+		return nil
+	}
+	if unknown := tuicUnknownParams(u.Query()); len(unknown) > 0 {
+		return []string{"tuic: ignored unknown parameters: " + strings.Join(unknown, ", ")}
+	}
+	return nil
+}
+
+// IsURISupported возвращает true, если URI поддерживается sing-box (vmess, vless, trojan, ss и ss поверх ShadowTLS,
+// hysteria2, tuic, wireguard, socks, http(s), naive, anytls с транспортами, которые есть в sing-box — см. v2rayTransport). Используется для фильтрации списка серверов в UI.
 func IsURISupported(uri string) bool {
 	_, err := outboundFromURI(uri)
 	return err == nil
@@ -73,6 +233,15 @@ func outboundFromURI(raw string) (map[string]any, error) {
 	if strings.HasPrefix(raw, "vmess://") {
 		return vmessOutbound(raw)
 	}
+	lower := strings.ToLower(raw)
+	// hysteria2 допускает диапазоны портов в authority, которые url.Parse отвергает.
+	if strings.HasPrefix(lower, "hysteria2://") || strings.HasPrefix(lower, "hy2://") {
+		return hysteria2Outbound(raw)
+	}
+	// В ключах WireGuard бывает неэкранированный '/', url.Parse разобрал бы такую ссылку неверно.
+	if strings.HasPrefix(lower, "wireguard://") || strings.HasPrefix(lower, "wg://") {
+		return wireguardEndpoint(raw)
+	}
 
 	parsed, err := url.Parse(raw)
 	if err != nil {
@@ -86,8 +255,18 @@ func outboundFromURI(raw string) (map[string]any, error) {
 		return trojanOutbound(parsed)
 	case "ss":
 		return shadowsocksOutbound(parsed)
+	case "tuic":
+		return tuicOutbound(parsed)
+	case "socks", "socks5", "socks5h", "socks4", "socks4a":
+		return socksOutbound(parsed)
+	case "http", "https":
+		return httpOutbound(parsed)
+	case "naive+https", "naive+quic":
+		return naiveOutbound(parsed)
+	case "anytls":
+		return anytlsOutbound(parsed)
 	default:
-		return nil, fmt.Errorf("unsupported scheme: %s", parsed.Scheme)
+		return nil, fmt.Errorf("%w: %s", subscription.ErrUnsupportedScheme, parsed.Scheme)
 	}
 }
 
@@ -107,6 +286,27 @@ func splitHostPort(hostport string) (string, int, error) {
 	return host, p, nil
 }
 
+// firstQuery возвращает первое непустое значение среди ключей (ссылки разных клиентов называют параметры по-разному).
+func firstQuery(q url.Values, keys ...string) string {
+	for _, k := range keys {
+		if v := q.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// queryBool — true, если любой из ключей равен "1"/"true"/"yes".
+func queryBool(q url.Values, keys ...string) bool {
+	for _, k := range keys {
+		switch strings.ToLower(q.Get(k)) {
+		case "1", "true", "yes":
+			return true
+		}
+	}
+	return false
+}
+
 func vlessOutbound(u *url.URL) (map[string]any, error) {
 	host, port, err := splitHostPort(u.Host)
 	if err != nil {
@@ -125,16 +325,8 @@ func vlessOutbound(u *url.URL) (map[string]any, error) {
 	}
 
 	q := u.Query()
-	security := strings.ToLower(q.Get("security")) // tls / reality / ""
 	transportType := strings.ToLower(q.Get("type")) // ws / grpc / tcp
 	flow := q.Get("flow")
-	sni := q.Get("sni")
-	if sni == "" {
-		sni = q.Get("host")
-	}
-	if sni == "" && host != "" {
-		sni = host
-	}
 
 	out := map[string]any{
 		"type":        "vless",
@@ -145,35 +337,11 @@ func vlessOutbound(u *url.URL) (map[string]any, error) {
 	if flow != "" {
 		out["flow"] = flow
 	}
-
-	if security == "tls" || security == "reality" {
-		tls := map[string]any{"enabled": true}
-		if sni != "" {
-			tls["server_name"] = sni
-		}
-		if alpn := q.Get("alpn"); alpn != "" {
-			tls["alpn"] = strings.Split(alpn, ",")
-		}
-		if security == "reality" {
-			pbk := q.Get("pbk")
-			sid := q.Get("sid")
-			if pbk != "" && sid != "" {
-				tls["reality"] = map[string]any{
-					"enabled":    true,
-					"public_key": pbk,
-					"short_id":   sid,
-				}
-				// Reality client требует uTLS (fingerprint браузера).
-				fp := q.Get("fp")
-				if fp == "" {
-					fp = "chrome"
-				}
-				tls["utls"] = map[string]any{
-					"enabled":    true,
-					"fingerprint": fp,
-				}
-			}
-		}
+	tls, err := shareLinkTLS(q, "none", host)
+	if err != nil {
+		return nil, err
+	}
+	if tls != nil {
 		out["tls"] = tls
 	}
 
@@ -184,6 +352,9 @@ func vlessOutbound(u *url.URL) (map[string]any, error) {
 	if transport != nil {
 		out["transport"] = transport
 	}
+	if err := finishTransport(out, linkServerName(q, host)); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
@@ -206,21 +377,18 @@ func trojanOutbound(u *url.URL) (map[string]any, error) {
 	q := u.Query()
 	transportType := strings.ToLower(q.Get("type"))
 
-	tls := map[string]any{"enabled": true}
-	if sni := q.Get("sni"); sni != "" {
-		tls["server_name"] = sni
-	} else if host != "" {
-		tls["server_name"] = host
-	}
-	if alpn := q.Get("alpn"); alpn != "" {
-		tls["alpn"] = strings.Split(alpn, ",")
-	}
 	out := map[string]any{
 		"type":        "trojan",
 		"server":      host,
 		"server_port": port,
 		"password":    password,
-		"tls":         tls,
+	}
+	tls, err := shareLinkTLS(q, "tls", host)
+	if err != nil {
+		return nil, err
+	}
+	if tls != nil {
+		out["tls"] = tls
 	}
 	transport, err := v2rayTransport(transportType, q)
 	if err != nil {
@@ -229,6 +397,9 @@ func trojanOutbound(u *url.URL) (map[string]any, error) {
 	if transport != nil {
 		out["transport"] = transport
 	}
+	if err := finishTransport(out, linkServerName(q, host)); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
@@ -283,107 +454,147 @@ func shadowsocksOutbound(u *url.URL) (map[string]any, error) {
 		return nil, fmt.Errorf("shadowsocks: cannot parse method/password")
 	}
 
-	return map[string]any{
+	out := map[string]any{
 		"type":        "shadowsocks",
 		"server":      host,
 		"server_port": port,
 		"method":      method,
 		"password":    password,
-	}, nil
-}
-
-func vmessOutbound(raw string) (map[string]any, error) {
-	payload := strings.TrimPrefix(strings.TrimSpace(raw), "vmess://")
-	decoded, err := decodeBase64Compat(payload)
-	if err != nil {
-		return nil, err
 	}
-	var v struct {
-		Add  string `json:"add"`
-		Port string `json:"port"`
-		ID   string `json:"id"`
-		Aid  string `json:"aid"`
-		Net  string `json:"net"`
-		Type string `json:"type"`
-		Host string `json:"host"`
-		Path string `json:"path"`
-		TLS  string `json:"tls"`
-		SNI  string `json:"sni"`
-	}
-	if err := json.Unmarshal(decoded, &v); err != nil {
-		return nil, err
-	}
-	if v.Add == "" || v.ID == "" || v.Port == "" {
-		return nil, fmt.Errorf("vmess: missing add/id/port")
-	}
-	port, err := strconv.Atoi(v.Port)
-	if err != nil {
-		return nil, err
-	}
-
-	out := map[string]any{
-		"type":        "vmess",
-		"server":      v.Add,
-		"server_port": port,
-		"uuid":        v.ID,
-		"security":    "auto",
-		"alter_id":    0,
-	}
-
-	if v.Aid != "" {
-		if aid, err := strconv.Atoi(v.Aid); err == nil {
-			out["alter_id"] = aid
+	q := u.Query()
+	// ShadowTLS — не плагин sing-box, а отдельный outbound, через который идёт shadowsocks (detour).
+	var stls *shadowTLSOptions
+	if spec := q.Get("plugin"); spec != "" {
+		if name, opts, _ := strings.Cut(spec, ";"); strings.TrimSpace(name) == "shadow-tls" {
+			o := shadowTLSFromPlugin(opts)
+			stls = &o
+		} else {
+			plugin, opts, err := shadowsocksPlugin(spec)
+			if err != nil {
+				return nil, err
+			}
+			out["plugin"] = plugin
+			if opts != "" {
+				out["plugin_opts"] = opts
+			}
 		}
 	}
-
-	if strings.EqualFold(v.TLS, "tls") {
-		tls := map[string]any{"enabled": true}
-		serverName := v.SNI
-		if serverName == "" {
-			serverName = v.Host
-		}
-		if serverName == "" && v.Add != "" {
-			serverName = v.Add
+	if raw := q.Get("shadow-tls"); raw != "" && stls == nil {
+		o, err := shadowTLSFromParam(raw)
+		if err != nil {
+			return nil, err
 		}
-		if serverName != "" {
-			tls["server_name"] = serverName
+		stls = &o
+	}
+	if stls != nil {
+		detour, err := shadowTLSOutbound(host, port, *stls)
+		if err != nil {
+			return nil, err
 		}
-		out["tls"] = tls
+		out["detour"] = detour
 	}
+	return out, nil
+}
 
-	q := url.Values{}
-	if v.Path != "" {
-		q.Set("path", v.Path)
-	}
-	if v.Host != "" {
-		q.Set("host", v.Host)
-	}
-	transport, err := v2rayTransport(strings.ToLower(v.Net), q)
-	if err != nil {
-		return nil, err
-	}
-	if transport != nil {
-		out["transport"] = transport
+// shadowsocksPlugin разбирает SIP002 plugin ("obfs-local;obfs=http;obfs-host=example.com") в имя и опции для sing-box.
+// sing-box умеет только obfs-local и v2ray-plugin; для остальных возвращаем ошибку, а не молча подключаемся без плагина.
+func shadowsocksPlugin(spec string) (string, string, error) {
+	name, opts, _ := strings.Cut(spec, ";")
+	switch name = strings.TrimSpace(name); name {
+	case "obfs-local", "simple-obfs":
+		name = "obfs-local"
+	case "v2ray-plugin":
+	default:
+		return "", "", fmt.Errorf("shadowsocks: %w: plugin %s", subscription.ErrUnsupportedTransport, name)
 	}
+	return name, strings.TrimSpace(opts), nil
+}
 
-	return out, nil
+// unsupportedTransports — транспорты Xray/v2ray, которых нет в sing-box, и почему.
+// Такие узлы не подключаются, а причина видна в отчёте о разборе подписки.
+var unsupportedTransports = map[string]string{
+	"xhttp":        "xhttp is implemented only in Xray",
+	"splithttp":    "splithttp (xhttp) is implemented only in Xray",
+	"kcp":          "mKCP is not implemented in sing-box",
+	"mkcp":         "mKCP is not implemented in sing-box",
+	"domainsocket": "domain sockets cannot reach a remote server",
 }
 
+// v2rayTransport собирает sing-box transport из параметров share-ссылки (type и сопутствующие).
+// Параметры: path, host, serviceName, headerType (маскировка tcp под HTTP), quicSecurity,
+// ed/eh — ранние данные WebSocket (их же Xray кладёт в path как "?ed=2048").
 func v2rayTransport(kind string, q url.Values) (map[string]any, error) {
+	header := strings.ToLower(q.Get("headerType"))
 	switch kind {
-	case "", "tcp":
-		return nil, nil
+	case "", "tcp", "raw":
+		switch header {
+		case "", "none":
+			return nil, nil
+		case "http":
+			// Без TLS http-транспорт sing-box — HTTP/1.1, совместимый с tcp + http header в v2ray
+			// (method отличает этот случай от h2, см. finishTransport).
+			h := map[string]any{"type": "http", "method": "GET"}
+			if hosts := subscription.SplitList(q.Get("host")); len(hosts) > 0 {
+				h["host"] = hosts
+			}
+			if path := firstListItem(q.Get("path")); path != "" {
+				h["path"] = path
+			}
+			return h, nil
+		default:
+			return nil, fmt.Errorf("%w: tcp header %s", subscription.ErrUnsupportedTransport, header)
+		}
 	case "ws", "websocket":
 		ws := map[string]any{
 			"type": "ws",
 		}
-		if path := q.Get("path"); path != "" {
+		path, earlyData := splitEarlyData(q.Get("path"))
+		if path != "" {
 			ws["path"] = path
 		}
 		if host := q.Get("host"); host != "" {
 			ws["headers"] = map[string]any{"Host": host}
 		}
+		if ed := firstQuery(q, "ed", "max_early_data"); ed != "" {
+			n, err := strconv.Atoi(ed)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("ws: invalid early data size: %s", ed)
+			}
+			earlyData = n
+		}
+		if earlyData > 0 {
+			ws["max_early_data"] = earlyData
+			// Xray передаёт ранние данные в Sec-WebSocket-Protocol; другое имя задают через eh.
+			name := firstQuery(q, "eh", "early_data_header_name")
+			if name == "" {
+				name = "Sec-WebSocket-Protocol"
+			}
+			ws["early_data_header_name"] = name
+		}
 		return ws, nil
+	case "httpupgrade":
+		hu := map[string]any{
+			"type": "httpupgrade",
+		}
+		// Ранних данных у httpupgrade в sing-box нет; ?ed= из пути просто убираем.
+		if path, _ := splitEarlyData(q.Get("path")); path != "" {
+			hu["path"] = path
+		}
+		if host := q.Get("host"); host != "" {
+			hu["host"] = host
+		}
+		return hu, nil
+	case "http", "h2":
+		h := map[string]any{
+			"type": "http",
+		}
+		if hosts := subscription.SplitList(q.Get("host")); len(hosts) > 0 {
+			h["host"] = hosts
+		}
+		if path := q.Get("path"); path != "" {
+			h["path"] = path
+		}
+		return h, nil
 	case "grpc":
 		grpc := map[string]any{
 			"type": "grpc",
@@ -392,9 +603,55 @@ func v2rayTransport(kind string, q url.Values) (map[string]any, error) {
 			grpc["service_name"] = serviceName
 		}
 		return grpc, nil
+	case "quic":
+		// Шифрование и маскировка заголовков QUIC из v2ray в sing-box не поддерживаются.
+		if security := strings.ToLower(q.Get("quicSecurity")); (security != "" && security != "none") || (header != "" && header != "none") {
+			return nil, fmt.Errorf("%w: quic with quicSecurity/headerType is not implemented in sing-box", subscription.ErrUnsupportedTransport)
+		}
+		return map[string]any{"type": "quic"}, nil
 	default:
-		return nil, fmt.Errorf("unsupported transport: %s", kind)
+		if reason, ok := unsupportedTransports[kind]; ok {
+			return nil, fmt.Errorf("%w: %s", subscription.ErrUnsupportedTransport, reason)
+		}
+		return nil, fmt.Errorf("%w: %s", subscription.ErrUnsupportedTransport, kind)
+	}
+}
+
+// splitEarlyData вынимает ?ed=N из пути ws (так Xray задаёт 0-RTT) и возвращает путь без него.
+func splitEarlyData(path string) (string, int) {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path, 0
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return path, 0
+	}
+	ed, err := strconv.Atoi(q.Get("ed"))
+	if err != nil || ed <= 0 {
+		return path, 0
+	}
+	q.Del("ed")
+	if rest := q.Encode(); rest != "" {
+		base += "?" + rest
+	}
+	return base, ed
+}
+
+// finishTransport сверяет транспорт с TLS узла: quic без TLS не бывает (в v2ray он неявный,
+// sing-box требует явно), а маскировка tcp под HTTP поверх TLS в sing-box превратилась бы в h2.
+func finishTransport(out map[string]any, serverName string) error {
+	t, ok := out["transport"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	switch {
+	case t["type"] == "quic" && out["tls"] == nil:
+		out["tls"] = map[string]any{"enabled": true, "server_name": serverName}
+	case t["type"] == "http" && t["method"] != nil && out["tls"] != nil:
+		return fmt.Errorf("%w: tcp http header over tls is not implemented in sing-box", subscription.ErrUnsupportedTransport)
 	}
+	return nil
 }
 
 func decodeBase64Compat(input string) ([]byte, error) {